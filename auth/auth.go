@@ -1,21 +1,26 @@
 package auth
 
 import (
+	"bufio"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"io"
-	"log"
 	"net/http"
-	"time"
+	"os"
+	"strings"
 
 	"github.com/brianloveswords/spotify/logger"
-	"github.com/brianloveswords/spotify/util"
+	"github.com/brianloveswords/spotify/xdg"
+	"github.com/fatih/color"
 	"github.com/lpabon/godbc"
 	"github.com/zmb3/spotify"
 	"golang.org/x/oauth2"
 )
 
-const redirectURL = "http://localhost:8888"
+// DefaultRedirectURL is where spotify sends the browser after login. It
+// has to exactly match a redirect URL registered for the app.
+const DefaultRedirectURL = "http://localhost:8888"
 
 var permissions = []string{
 	spotify.ScopeUserReadPrivate,
@@ -24,103 +29,195 @@ var permissions = []string{
 	spotify.ScopePlaylistModifyPublic,
 	spotify.ScopeUserLibraryModify,
 	spotify.ScopeUserModifyPlaybackState,
+	spotify.ScopeUserReadPlaybackState,
 	spotify.ScopeUserReadCurrentlyPlaying,
 	spotify.ScopeUserReadRecentlyPlayed,
 }
 
 var glog = logger.DefaultLogger
-var client *spotify.Client
 
-func SetupClient() *spotify.Client {
-	// TODO: if the token is older than a certain timeframe, force revalidation
+// refreshLockName is the lock held while SetupClient decides whether
+// the token needs refreshing or replacing and does it.
+const refreshLockName = "oauth-refresh"
 
-	defer glog.Enter("auth.SetupClient")()
+// tokenURL is where codes and refresh tokens are traded for tokens.
+var tokenURL = spotify.TokenURL
 
-	// the redirect URL must be an exact match of a URL you've registered for your application
-	// scopes determine which permissions the user is prompted to authorize
-	var tok *oauth2.Token
+// SetupClient returns a client for the saved token, logging in first if
+// there isn't one, or if the app has started asking for permissions the
+// token wasn't granted. A token close to expiring is refreshed up front,
+// and any token the client gets from refreshing is saved. Loading the
+// token means decrypting it, so commands should call this once and pass
+// the client to whatever needs it.
+func SetupClient() *spotify.Client {
+	client := spotify.NewClient(SetupHTTPClient())
+	return &client
+}
 
-	auth := spotify.NewAuthenticator(redirectURL, permissions...)
+// SetupHTTPClient is SetupClient for requests the spotify client can't
+// make. The HTTP client it returns authorizes every request with the
+// saved token; wrap it with spotify.NewClient to have both.
+func SetupHTTPClient() *http.Client {
+	defer glog.Enter("auth.SetupHTTPClient")()
+
+	if apiURL := os.Getenv(APIURLEnv); apiURL != "" {
+		glog.Debug("using API at %s", apiURL)
+		c, err := NewHTTPClientWithBaseURL(apiURL, &oauth2.Token{
+			AccessToken: "placeholder",
+			TokenType:   "Bearer",
+		})
+		if err != nil {
+			glog.Fatal(err.Error())
+		}
+		return c
+	}
 
-	id, secret := clientID, clientSecret
-	auth.SetAuthInfo(id, secret)
+	// two commands started at once, like a key binding firing twice,
+	// shouldn't both refresh the token or both log in
+	unlock, err := appdir.Lock(refreshLockName)
+	if err != nil {
+		glog.Fatal("%s", err)
+	}
+	defer unlock()
 
 	// see if we can just load a token straight up
-	tok = loadToken()
-
-	if tok != nil {
-		expiry := tok.Expiry
-		defer func() {
-			if newtok, err := client.Token(); err == nil {
-				if newtok.Expiry.After(expiry) {
-					glog.Debug("saving new token: %v", tok.Expiry)
-					saveToken(tok)
-				}
-			}
-		}()
-
-		c := auth.NewClient(tok)
-		client = &c
-		godbc.Ensure(client != nil, "failed to create client")
-		return client
+	tok, err := loadToken()
+
+	if err == ErrNotLoggedIn {
+		tok = mustLogin("not logged in")
+	} else if err != nil {
+		tok = offerLogin(err)
+	} else if missing, err := MissingScopes(); err != nil {
+		glog.Fatal("couldn't read granted scopes: %s", err)
+	} else if len(missing) > 0 {
+		tok = mustLogin("new permissions needed: " + strings.Join(missing, " "))
+	} else if needsRefresh(tok) {
+		glog.Debug("token expires %s, refreshing", tok.Expiry)
+		newtok, err := refreshToken(tok)
+		if err != nil {
+			glog.Fatal("couldn't refresh token, try %s: %s", color.CyanString("auth login"), err)
+		}
+		tok = newtok
+		if err := persistToken(tok); err != nil {
+			glog.Log("couldn't save refreshed token: %s", err)
+		}
+	}
+
+	client := newSavingClient(tok)
+	godbc.Ensure(client != nil, "failed to create client")
+	return client
+}
+
+// offerLogin asks whether to log in again when the saved token can't be
+// used, exiting if the answer is no or there's nobody to ask.
+func offerLogin(err error) *oauth2.Token {
+	if !IsTokenError(err, 0) || glog.IsLevelSilent() {
+		glog.Fatal("couldn't load saved token: %s", err)
+	}
+	glog.Log("the saved login can't be used: %s", err)
+	glog.Prompt("log in again? [Y/n]")
+	text, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(text)) {
+	case "", "y", "yes":
+	default:
+		glog.Fatal("not logging in, see %s or %s", color.CyanString("auth login"), color.CyanString("auth import"))
+	}
+	return mustLogin("replacing the saved login")
+}
+
+// mustLogin logs in, explaining why first, or exits if it can't ask.
+func mustLogin(why string) *oauth2.Token {
+	if glog.IsLevelSilent() {
+		glog.Fatal("%s, see %s", why, color.CyanString("auth login"))
+	}
+	glog.Log("%s, logging in", why)
+	tok, err := Login(DefaultLoginOptions())
+	if err != nil {
+		glog.Fatal("couldn't log in: %s", err)
 	}
+	return tok
+}
 
-	var s *http.Server
+// ErrNotLoggedIn is returned when there's no saved token.
+var ErrNotLoggedIn = errors.New("not logged in")
 
-	state := randomState()
+// Logout deletes the saved token.
+func Logout() error {
+	forgetScopes()
+	return tokenStore().Remove()
+}
 
-	// if you didn't store your ID and secret key in the specified environment variables,
-	// you can set them manually here
-	// auth.SetAuthInfo(clientID, secretKey)
+// SavedToken returns the saved token without refreshing it.
+func SavedToken() (*oauth2.Token, error) {
+	return loadToken()
+}
 
-	// get the user to this URL - how you do that is up to you
-	// you should specify a unique state string to identify the session
-	url := auth.AuthURL(state)
+// Scopes returns the permissions the app asks for when logging in.
+func Scopes() []string {
+	return append([]string{}, permissions...)
+}
 
-	util.OpenURL(url, false)
+// NewClient makes a spotify client for tok whose requests go through a
+// fetch.Transport, so rate limited and flaky requests get retried.
+func NewClient(tok *oauth2.Token) *spotify.Client {
+	client := spotify.NewClient(oauthConfig(DefaultRedirectURL).Client(httpContext(), tok))
+	return &client
+}
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// use the same state string here that you used to generate the URL
-		token, err := auth.Token(state, r)
-		if err != nil {
-			http.Error(w, "Couldn't get token", http.StatusNotFound)
-			return
-		}
-		// save the token and create that shizz
-		saveToken(token)
-		c := auth.NewClient(token)
-		client = &c
-
-		w.WriteHeader(200)
-		w.Write([]byte("<html><body>cool thx<script>window.close()</script>"))
-
-		// we need to let the handler function complete in order for the
-		// writes to be flushed, so we stick the s.Close() in a
-		// goroutine that waits just a hot (milli)second before closing
-		// the server.
-		go func() {
-			time.Sleep(1 * time.Millisecond)
-			s.Close()
-		}()
-	})
-
-	s = &http.Server{
-		Addr:           ":8888",
-		Handler:        mux,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
-		MaxHeaderBytes: 1 << 20,
+// newSavingClient is an HTTP client like NewClient's, but every token it
+// refreshes to is saved.
+func newSavingClient(tok *oauth2.Token) *http.Client {
+	return savingClientFor(appdir, tokenStore(), tok)
+}
+
+// ClientFor makes a spotify client for the token saved in app's
+// directories, which are those of a profile other than this run's, say.
+// Any token it refreshes to is saved back there. The token it started
+// with is returned too.
+func ClientFor(app *xdg.App) (*spotify.Client, *oauth2.Token, error) {
+	s, err := storeFor(app)
+	if err != nil {
+		return nil, nil, err
+	}
+	tok, err := s.Load()
+	if err != nil {
+		return nil, nil, err
 	}
+	client := spotify.NewClient(savingClientFor(app, s, tok))
+	return &client, tok, nil
+}
 
-	if err := s.ListenAndServe(); err != nil {
-		if err != http.ErrServerClosed {
-			log.Fatal(err)
-		}
+// savingClientFor is newSavingClient for the token kept in s, in app's
+// directories.
+func savingClientFor(app *xdg.App, s TokenStore, tok *oauth2.Token) *http.Client {
+	ctx := httpContext()
+	src := &savingTokenSource{
+		src:  oauthConfig(DefaultRedirectURL).TokenSource(ctx, tok),
+		last: tok.AccessToken,
+		save: func(tok *oauth2.Token) error {
+			return persistTokenIn(app, s, tok)
+		},
 	}
+	return oauth2.NewClient(ctx, src)
+}
 
-	godbc.Ensure(client != nil, "failed to create client")
-	return client
+func oauthConfig(redirectURL string) *oauth2.Config {
+	config := &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       permissions,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  spotify.AuthURL,
+			TokenURL: tokenURL,
+		},
+	}
+	if usePKCE() {
+		// without a secret there's nothing to put in a basic auth
+		// header, spotify wants the client ID in the form instead
+		config.Endpoint.AuthStyle = oauth2.AuthStyleInParams
+	}
+	return config
 }
 
 func randomState() string {
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/brianloveswords/spotify/fetch"
+	"github.com/zmb3/spotify"
+	"golang.org/x/oauth2"
+)
+
+// DefaultAPIURL is where the spotify client sends API requests.
+const DefaultAPIURL = "https://api.spotify.com/v1/"
+
+// APIURLEnv is the environment variable that points the client at a
+// different API, e.g. the fake server in spotifytest. Login is skipped
+// when it's set, since nothing but spotify can hand out real tokens.
+const APIURLEnv = "SPOTIFY_API_URL"
+
+// NewClientWithBaseURL returns a client that sends every API request to
+// baseURL instead of spotify, authorized with tok. The token is never
+// refreshed.
+func NewClientWithBaseURL(baseURL string, tok *oauth2.Token) (spotify.Client, error) {
+	client, err := NewHTTPClientWithBaseURL(baseURL, tok)
+	if err != nil {
+		return spotify.Client{}, err
+	}
+	return spotify.NewClient(client), nil
+}
+
+// NewHTTPClientWithBaseURL is NewClientWithBaseURL for requests the
+// spotify client can't make, see SetupHTTPClient.
+func NewHTTPClientWithBaseURL(baseURL string, tok *oauth2.Token) (*http.Client, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse API URL %q: %s", baseURL, err)
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("API URL %q must be absolute", baseURL)
+	}
+	rebase := &rebaseTransport{base: base, next: fetch.NewTransport(http.DefaultTransport)}
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Source: oauth2.StaticTokenSource(tok),
+			Base:   rebase,
+		},
+	}, nil
+}
+
+// rebaseTransport rewrites requests for DefaultAPIURL to go to base
+// instead. The spotify client builds its URLs from DefaultAPIURL and has
+// no way to change it, so this is the only place to do it.
+type rebaseTransport struct {
+	base *url.URL
+	next http.RoundTripper
+}
+
+func (t *rebaseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	u := req.URL.String()
+	if !strings.HasPrefix(u, DefaultAPIURL) {
+		return next.RoundTrip(req)
+	}
+	rebased, err := url.Parse(strings.TrimSuffix(t.base.String(), "/") + "/" + strings.TrimPrefix(u, DefaultAPIURL))
+	if err != nil {
+		return nil, err
+	}
+
+	// RoundTrippers mustn't modify the request they're given
+	clone := new(http.Request)
+	*clone = *req
+	clone.URL = rebased
+	clone.Host = rebased.Host
+	return next.RoundTrip(clone)
+}
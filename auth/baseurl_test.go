@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebaseTransport(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.URL.String())
+	}))
+	defer server.Close()
+
+	base, _ := url.Parse(server.URL + "/fake/v1")
+	client := &http.Client{Transport: &rebaseTransport{base: base}}
+
+	_, err := client.Get(DefaultAPIURL + "me/player/currently-playing?market=US")
+	assert.NoError(t, err)
+	_, err = client.Get(server.URL + "/elsewhere")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"/fake/v1/me/player/currently-playing?market=US",
+		"/elsewhere",
+	}, got)
+}
+
+func TestNewClientWithBaseURLNeedsAbsoluteURL(t *testing.T) {
+	_, err := NewClientWithBaseURL("/v1/", nil)
+	assert.Error(t, err)
+}
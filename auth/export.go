@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/oauth2"
+)
+
+// exportPassphrase asks for the passphrase exports are encrypted with.
+var exportPassphrase = promptPassphrase
+
+// exportKey encrypts exported tokens. It's derived from a passphrase
+// rather than anything on this machine, so the machine importing only
+// needs to be told the passphrase. The client credentials won't do:
+// they're in every copy of the binary, so anyone who got hold of an
+// export could decrypt it.
+func exportKey() ([]byte, error) {
+	passphrase, err := exportPassphrase()
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("empty passphrase")
+	}
+	return deriveKey(passphrase, "export:"+clientID)
+}
+
+// Export writes the saved token to w so it can be moved to another
+// machine with Import. The token is encrypted with the export key and
+// base64 encoded so it survives being pasted into a terminal.
+func Export(w io.Writer) error {
+	tok, err := SavedToken()
+	if err != nil {
+		return err
+	}
+	return writeExport(w, tok)
+}
+
+func writeExport(w io.Writer, tok *oauth2.Token) error {
+	b, err := encodeToken(tok)
+	if err != nil {
+		return fmt.Errorf("couldn't encode token: %s", err)
+	}
+	key, err := exportKey()
+	if err != nil {
+		return fmt.Errorf("couldn't derive export key: %s", err)
+	}
+	sealed, err := seal(key, b)
+	if err != nil {
+		return fmt.Errorf("couldn't encrypt token: %s", err)
+	}
+	_, err = fmt.Fprintln(w, base64.StdEncoding.EncodeToString(sealed))
+	return err
+}
+
+// Import reads a token written by Export and saves it as this machine's
+// token, encrypted with the local key.
+func Import(r io.Reader) (*oauth2.Token, error) {
+	tok, err := readExport(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveToken(tok); err != nil {
+		return nil, fmt.Errorf("couldn't save token: %s", err)
+	}
+	// whatever was granted to the token that was here before says
+	// nothing about this one
+	forgetScopes()
+	return tok, nil
+}
+
+func readExport(r io.Reader) (*oauth2.Token, error) {
+	// ask for the passphrase first, if r is the terminal too it'd be
+	// odd to paste the token and only then be asked
+	key, err := exportKey()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't derive export key: %s", err)
+	}
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(raw)))
+	if err != nil || len(sealed) == 0 {
+		return nil, fmt.Errorf("doesn't look like an exported token")
+	}
+	b, err := unseal(key, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt token, was it exported with another passphrase? %s", err)
+	}
+	tok, err := decodeToken(b)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode token: %s", err)
+	}
+	if tok.AccessToken == "" && tok.RefreshToken == "" {
+		return nil, fmt.Errorf("exported token is empty")
+	}
+	return tok, nil
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// fixedExportPassphrase makes exports use passphrase instead of asking
+// for one, returning a func that undoes it.
+func fixedExportPassphrase(passphrase string) func() {
+	ask := exportPassphrase
+	exportPassphrase = func() (string, error) { return passphrase, nil }
+	return func() { exportPassphrase = ask }
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	defer fixedExportPassphrase("passphrase")()
+	tok := &oauth2.Token{
+		AccessToken:  "accesstoken",
+		TokenType:    "Bearer",
+		RefreshToken: "refreshtoken",
+		Expiry:       time.Now().Round(time.Second),
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeExport(&buf, tok))
+	assert.True(t, strings.HasSuffix(buf.String(), "\n"))
+
+	// pasting tends to add whitespace around things
+	tok2, err := readExport(strings.NewReader("  " + buf.String() + "\n\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, tok.AccessToken, tok2.AccessToken)
+	assert.Equal(t, tok.RefreshToken, tok2.RefreshToken)
+	assert.True(t, tok.Expiry.Equal(tok2.Expiry))
+}
+
+func TestReadExportRejectsGarbage(t *testing.T) {
+	defer fixedExportPassphrase("passphrase")()
+	_, err := readExport(strings.NewReader(""))
+	assert.Error(t, err)
+
+	_, err = readExport(strings.NewReader("not base64!"))
+	assert.Error(t, err)
+
+	// a token sealed with the storage key instead of the export key
+	key, err := fileStore.key()
+	assert.NoError(t, err)
+	sealed, err := seal(key, []byte("hi"))
+	assert.NoError(t, err)
+	_, err = readExport(strings.NewReader(base64.StdEncoding.EncodeToString(sealed)))
+	assert.Error(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeExport(&buf, &oauth2.Token{AccessToken: "a"}))
+	raw, _ := base64.StdEncoding.DecodeString(strings.TrimSpace(buf.String()))
+	raw[len(raw)-1] ^= 0xff
+	_, err = readExport(strings.NewReader(base64.StdEncoding.EncodeToString(raw)))
+	assert.Error(t, err)
+}
+
+func TestExportPassphrase(t *testing.T) {
+	undo := fixedExportPassphrase("correct horse")
+	var buf bytes.Buffer
+	assert.NoError(t, writeExport(&buf, &oauth2.Token{AccessToken: "a"}))
+	tok, err := readExport(strings.NewReader(buf.String()))
+	assert.NoError(t, err)
+	assert.Equal(t, "a", tok.AccessToken)
+	undo()
+
+	defer fixedExportPassphrase("battery staple")()
+	_, err = readExport(strings.NewReader(buf.String()))
+	assert.Error(t, err)
+
+	exportPassphrase = func() (string, error) { return "", nil }
+	assert.Error(t, writeExport(&buf, &oauth2.Token{AccessToken: "a"}))
+}
+
+// fakeTTY points the passphrase prompt at a file holding typed, returning
+// a func that undoes it.
+func fakeTTY(t *testing.T, typed string) func() {
+	f, err := ioutil.TempFile("", "tty")
+	assert.NoError(t, err)
+	f.WriteString(typed)
+	f.Close()
+	path := ttyPath
+	ttyPath = f.Name()
+	env, hadEnv := os.LookupEnv(PassphraseEnv)
+	os.Unsetenv(PassphraseEnv)
+	return func() {
+		ttyPath = path
+		if hadEnv {
+			os.Setenv(PassphraseEnv, env)
+		}
+		os.Remove(f.Name())
+	}
+}
+
+func TestImportPipedExport(t *testing.T) {
+	defer Logout()
+	defer fakeTTY(t, "correct horse\n")()
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeExport(&buf, &oauth2.Token{AccessToken: "piped"}))
+
+	// as in: spotify auth export | spotify auth import
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+	go func() {
+		w.Write(buf.Bytes())
+		w.Close()
+	}()
+
+	tok, err := Import(os.Stdin)
+	assert.NoError(t, err, "the passphrase comes from the terminal, not stdin")
+	assert.Equal(t, "piped", tok.AccessToken)
+	saved, err := SavedToken()
+	assert.NoError(t, err)
+	assert.Equal(t, "piped", saved.AccessToken)
+}
+
+func TestPassphraseWithoutTerminal(t *testing.T) {
+	defer fakeTTY(t, "")()
+	ttyPath = "/nonexistent/tty"
+
+	_, err := promptPassphrase()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), PassphraseEnv)
+	}
+
+	os.Setenv(PassphraseEnv, "from env")
+	defer os.Unsetenv(PassphraseEnv)
+	passphrase, err := promptPassphrase()
+	assert.NoError(t, err)
+	assert.Equal(t, "from env", passphrase)
+}
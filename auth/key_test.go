@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestKeyIsCreatedOnceAndKept(t *testing.T) {
+	fileStore.cachedKey = nil
+	appdir.DataRemove(keyName)
+
+	key, err := fileStore.key()
+	assert.NoError(t, err)
+	assert.Len(t, key, 32)
+
+	// a fresh process reads the same key back from the file
+	fileStore.cachedKey = nil
+	key2, err := fileStore.key()
+	assert.NoError(t, err)
+	assert.Equal(t, key, key2)
+}
+
+func TestMigrateLegacyToken(t *testing.T) {
+	if clientSecret == "" {
+		t.Skip("no client secret, so no legacy key")
+	}
+	tok := &oauth2.Token{
+		AccessToken:  "accesstoken",
+		RefreshToken: "refreshtoken",
+		Expiry:       time.Now().Add(time.Hour),
+	}
+
+	// what saveToken used to write
+	key, err := legacyKey()
+	assert.NoError(t, err)
+	b, err := encodeToken(tok)
+	assert.NoError(t, err)
+	sealed, err := seal(key, b)
+	assert.NoError(t, err)
+	f, err := appdir.DataCreate(tokenName)
+	assert.NoError(t, err)
+	f.Write(sealed)
+	f.Close()
+
+	tok2, err := loadToken()
+	assert.NoError(t, err)
+	assert.Equal(t, tok.AccessToken, tok2.AccessToken)
+	assert.Equal(t, tok.RefreshToken, tok2.RefreshToken)
+
+	// and it's been saved again with the new key
+	f, err = appdir.DataOpen(tokenName)
+	assert.NoError(t, err)
+	migrated, _ := ioutil.ReadAll(f)
+	f.Close()
+	assert.False(t, bytes.Equal(sealed, migrated))
+	key, err = fileStore.key()
+	assert.NoError(t, err)
+	_, err = unseal(key, migrated)
+	assert.NoError(t, err)
+}
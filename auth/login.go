@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/brianloveswords/spotify/util"
+	"golang.org/x/oauth2"
+)
+
+// RedirectURLEnv and HeadlessEnv override the login defaults, see
+// DefaultLoginOptions.
+const (
+	RedirectURLEnv = "SPOTIFY_REDIRECT_URL"
+	HeadlessEnv    = "SPOTIFY_HEADLESS"
+)
+
+// LoginOptions control how Login gets the user through spotify's
+// authorization page.
+type LoginOptions struct {
+	// RedirectURL is where spotify sends the browser afterwards. It has
+	// to be registered for the app, and unless Headless is set a server
+	// listens on its port to catch the redirect.
+	RedirectURL string
+	// Headless prints the authorization URL instead of opening a
+	// browser, then reads the URL the browser was redirected to from
+	// In. For SSH sessions and the like, where nothing can reach a local
+	// server.
+	Headless bool
+	// In is where the headless flow reads from. Defaults to stdin.
+	In io.Reader
+}
+
+// DefaultLoginOptions uses DefaultRedirectURL unless SPOTIFY_REDIRECT_URL
+// is set, and goes headless when SPOTIFY_HEADLESS is set or there's no
+// way to open a browser, like over SSH.
+func DefaultLoginOptions() LoginOptions {
+	opts := LoginOptions{
+		RedirectURL: DefaultRedirectURL,
+		Headless:    os.Getenv(HeadlessEnv) != "" || !canOpenBrowser(),
+	}
+	if u := os.Getenv(RedirectURLEnv); u != "" {
+		opts.RedirectURL = u
+	}
+	return opts
+}
+
+func canOpenBrowser() bool {
+	if os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_TTY") != "" {
+		return false
+	}
+	if runtime.GOOS == "linux" {
+		return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+	}
+	return true
+}
+
+// RedirectURLForPort is DefaultRedirectURL on a different port, for when
+// 8888 is taken. The new URL has to be registered for the app too.
+func RedirectURLForPort(port int) string {
+	return fmt.Sprintf("http://localhost:%d", port)
+}
+
+// Login sends the user to spotify to authorize the app, gets the code
+// spotify hands back, exchanges it for a token and saves the token,
+// replacing any saved one.
+func Login(opts LoginOptions) (*oauth2.Token, error) {
+	defer glog.Enter("auth.Login")()
+
+	if opts.RedirectURL == "" {
+		opts.RedirectURL = DefaultRedirectURL
+	}
+	if opts.In == nil {
+		opts.In = os.Stdin
+	}
+
+	// the redirect URL must be an exact match of a URL you've registered for your application
+	// scopes determine which permissions the user is prompted to authorize
+	config := oauthConfig(opts.RedirectURL)
+
+	// the state is echoed back in the redirect, which is how we know
+	// the code is for this login and not something forged
+	state := randomState()
+
+	var authOpts, exchangeOpts []oauth2.AuthCodeOption
+	if usePKCE() {
+		glog.Debug("no client secret, using PKCE")
+		authOpts, exchangeOpts = pkceOptions(newCodeVerifier())
+	}
+	authURL := config.AuthCodeURL(state, authOpts...)
+
+	var (
+		code string
+		err  error
+	)
+	if opts.Headless {
+		code, err = readCallback(opts.In, authURL, state)
+	} else {
+		code, err = serveCallback(opts.RedirectURL, authURL, state)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tok, err := config.Exchange(context.Background(), code, exchangeOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't exchange code for token: %s", err)
+	}
+	if err := persistToken(tok); err != nil {
+		return nil, fmt.Errorf("couldn't save token: %s", err)
+	}
+	return tok, nil
+}
+
+// readCallback asks the user to open authURL somewhere with a browser
+// and paste back where they ended up.
+func readCallback(in io.Reader, authURL, state string) (string, error) {
+	if glog.IsLevelSilent() {
+		return "", fmt.Errorf("can't log in without a browser when --silent, since it doesn't read stdin")
+	}
+	glog.Log("open this URL in a browser and log in:\n\n%s\n", authURL)
+	glog.Log("afterwards the browser will try to load a page that probably won't work,")
+	glog.Log("copy the whole URL it ended up on")
+
+	reader := bufio.NewReader(in)
+	for {
+		glog.Prompt("paste the URL here")
+		text, err := reader.ReadString('\n')
+		text = strings.TrimSpace(text)
+		if text == "" {
+			if err != nil {
+				return "", fmt.Errorf("no code entered")
+			}
+			continue
+		}
+		code, perr := parseCallback(text, state)
+		if perr == nil {
+			return code, nil
+		}
+		if err != nil {
+			return "", perr
+		}
+		glog.Log("%s, try again", perr)
+	}
+}
+
+// parseCallback gets the code out of what the user pasted, which is
+// either the whole redirect URL or its query string. A bare code isn't
+// accepted, since without the state there's no telling whether it came
+// from this login.
+func parseCallback(pasted, state string) (string, error) {
+	pasted = strings.TrimSpace(pasted)
+	if !strings.Contains(pasted, "=") {
+		return "", fmt.Errorf("that doesn't look like the redirect URL, paste all of it")
+	}
+
+	query := pasted
+	if i := strings.Index(pasted, "?"); i >= 0 {
+		query = pasted[i+1:]
+	}
+	if i := strings.Index(query, "#"); i >= 0 {
+		query = query[:i]
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("couldn't parse %q: %s", pasted, err)
+	}
+	return codeFromValues(values, state)
+}
+
+func codeFromValues(values url.Values, state string) (string, error) {
+	if e := values.Get("error"); e != "" {
+		return "", fmt.Errorf("spotify refused the login: %s", e)
+	}
+	if values.Get("state") != state {
+		return "", fmt.Errorf("state doesn't match, this isn't the redirect for this login")
+	}
+	code := values.Get("code")
+	if code == "" {
+		return "", fmt.Errorf("no code in the redirect")
+	}
+	return code, nil
+}
+
+// serveCallback opens authURL in the browser and waits for spotify to
+// redirect it back to a server on redirectURL's port.
+func serveCallback(redirectURL, authURL, state string) (string, error) {
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return "", fmt.Errorf("couldn't parse redirect URL %q: %s", redirectURL, err)
+	}
+	port := u.Port()
+	if port == "" {
+		return "", fmt.Errorf("redirect URL %q needs a port to listen on", redirectURL)
+	}
+	listener, err := net.Listen("tcp", ":"+port)
+	if err != nil {
+		return "", fmt.Errorf("couldn't listen for the login redirect on port %s, use --port or --headless: %s", port, err)
+	}
+
+	type result struct {
+		code string
+		err  error
+	}
+	done := make(chan result, 1)
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		code, err := codeFromValues(r.URL.Query(), state)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			glog.Debug("bad login redirect %s: %s", r.URL, err)
+			// a stray request shouldn't end the login, but the user
+			// saying no should
+			if r.URL.Query().Get("error") != "" {
+				select {
+				case done <- result{"", err}:
+				default:
+				}
+			}
+			return
+		}
+		w.WriteHeader(200)
+		w.Write([]byte("<html><body>cool thx<script>window.close()</script>"))
+		select {
+		case done <- result{code, nil}:
+		default:
+		}
+	})
+
+	s := &http.Server{
+		Handler:        mux,
+		ReadTimeout:    10 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		MaxHeaderBytes: 1 << 20,
+	}
+	go func() {
+		if err := s.Serve(listener); err != nil && err != http.ErrServerClosed {
+			done <- result{"", err}
+		}
+	}()
+
+	glog.Log("waiting for login, if a browser doesn't open go to:\n\n%s\n", authURL)
+	util.OpenURL(authURL, false)
+
+	res := <-done
+
+	// let the handler finish writing before shutting down
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s.Shutdown(ctx)
+
+	return res.code, res.err
+}
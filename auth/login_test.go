@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCallback(t *testing.T) {
+	for _, pasted := range []string{
+		"http://localhost:8888/?code=abc123&state=xyz",
+		"  http://localhost:8888?state=xyz&code=abc123\n",
+		"?code=abc123&state=xyz",
+		"code=abc123&state=xyz",
+	} {
+		code, err := parseCallback(pasted, "xyz")
+		assert.NoError(t, err, pasted)
+		assert.Equal(t, "abc123", code, pasted)
+	}
+
+	// a bare code has no state to check
+	_, err := parseCallback("abc123", "xyz")
+	assert.Error(t, err)
+	_, err = parseCallback("http://localhost:8888/?code=abc123&state=forged", "xyz")
+	assert.Error(t, err)
+	_, err = parseCallback("http://localhost:8888/?code=abc123", "xyz")
+	assert.Error(t, err)
+	_, err = parseCallback("http://localhost:8888/?error=access_denied&state=xyz", "xyz")
+	assert.Contains(t, err.Error(), "access_denied")
+	_, err = parseCallback("http://localhost:8888/?state=xyz", "xyz")
+	assert.Error(t, err)
+}
+
+func TestReadCallbackRetries(t *testing.T) {
+	in := strings.NewReader("\nhttp://localhost:8888/?code=abc&state=wrong\nhttp://localhost:8888/?code=abc&state=xyz\n")
+	code, err := readCallback(in, "https://accounts.spotify.com/authorize", "xyz")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", code)
+
+	_, err = readCallback(strings.NewReader("?code=abc&state=wrong"), "", "xyz")
+	assert.Error(t, err)
+
+	_, err = readCallback(strings.NewReader(""), "", "xyz")
+	assert.Error(t, err)
+}
+
+func TestRedirectURLForPort(t *testing.T) {
+	assert.Equal(t, "http://localhost:9999", RedirectURLForPort(9999))
+}
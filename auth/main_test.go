@@ -0,0 +1,16 @@
+package auth
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// keep tests away from the real token and key files
+func TestMain(m *testing.M) {
+	appdir.AppFs = afero.NewMemMapFs()
+	appdir.Home = "/home/test"
+	appdir.MakeDirs()
+	os.Exit(m.Run())
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+
+	"golang.org/x/oauth2"
+)
+
+// usePKCE reports whether to log in with the PKCE flow, which proves the
+// code exchange comes from whoever started the login with a one-off
+// verifier instead of the client secret. Builds without a secret have
+// no other choice.
+func usePKCE() bool {
+	return clientSecret == ""
+}
+
+// newCodeVerifier returns a random PKCE code verifier: 32 random bytes
+// make 43 characters of base64, the shortest verifier allowed.
+func newCodeVerifier() string {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// pkceOptions returns the extra parameters for the authorization URL
+// and for the code exchange.
+func pkceOptions(verifier string) (auth, exchange []oauth2.AuthCodeOption) {
+	auth = []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge", codeChallenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+	exchange = []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_verifier", verifier),
+	}
+	return auth, exchange
+}
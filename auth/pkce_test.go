@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestCodeVerifier(t *testing.T) {
+	v := newCodeVerifier()
+	assert.Len(t, v, 43)
+	assert.Regexp(t, `^[A-Za-z0-9_-]+$`, v)
+	assert.NotEqual(t, v, newCodeVerifier())
+}
+
+func TestCodeChallenge(t *testing.T) {
+	// base64url(sha256(verifier)) without padding
+	assert.Equal(t, "b3ddeuIrzQNiDhjNfpbNgh0gk3R_rfQt1bwYH6xbA28",
+		codeChallenge("dBjftJeZ4CVP-mJ0kq6RP3ZT-jHG5k1OQh2yqUbHqjE"))
+}
+
+func TestPKCEOptions(t *testing.T) {
+	authOpts, _ := pkceOptions("verifier")
+	config := &oauth2.Config{ClientID: "id", Endpoint: oauth2.Endpoint{AuthURL: "https://example.com/auth"}}
+	u, err := url.Parse(config.AuthCodeURL("state", authOpts...))
+	assert.NoError(t, err)
+	assert.Equal(t, codeChallenge("verifier"), u.Query().Get("code_challenge"))
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brianloveswords/spotify/fetch"
+	"github.com/brianloveswords/spotify/xdg"
+	"golang.org/x/oauth2"
+)
+
+// refreshMargin is how close to expiring a token has to be for
+// SetupClient to refresh it before doing anything else. Tokens last an
+// hour, so this is mostly about not having one expire halfway through a
+// long command.
+var refreshMargin = 10 * time.Minute
+
+// scopesName is the data file holding the scopes the saved token was
+// granted, as spotify reported them.
+var scopesName = "oauth-scopes"
+
+func needsRefresh(tok *oauth2.Token) bool {
+	return !tok.Expiry.IsZero() && time.Until(tok.Expiry) < refreshMargin
+}
+
+// refreshToken trades tok's refresh token for a new token, whether or
+// not tok has expired yet.
+func refreshToken(tok *oauth2.Token) (*oauth2.Token, error) {
+	defer glog.Enter("auth.refreshToken")()
+
+	stale := *tok
+	stale.AccessToken = ""
+	return oauthConfig(DefaultRedirectURL).TokenSource(httpContext(), &stale).Token()
+}
+
+// persistToken saves tok along with the scopes it was granted, when the
+// response it came from said what they were.
+func persistToken(tok *oauth2.Token) error {
+	return persistTokenIn(appdir, tokenStore(), tok)
+}
+
+// persistTokenIn is persistToken for the token kept in s, in app's
+// directories.
+func persistTokenIn(app *xdg.App, s TokenStore, tok *oauth2.Token) error {
+	if err := s.Save(tok); err != nil {
+		return err
+	}
+	scope, _ := tok.Extra("scope").(string)
+	if scope == "" {
+		return nil
+	}
+	return writeDataFile(app, scopesName, []byte(scope))
+}
+
+// forgetScopes removes the record of granted scopes, for when the token
+// they belonged to is gone or replaced by one we know nothing about.
+func forgetScopes() {
+	if err := removeDataFile(appdir, scopesName); err != nil && err != ErrNotLoggedIn {
+		glog.Debug("couldn't remove %s: %s", scopesName, err)
+	}
+}
+
+// GrantedScopes returns the scopes the saved token was granted, or nil
+// if that isn't known, as for tokens saved before scopes were recorded or
+// imported from elsewhere. It becomes known the next time the token is
+// refreshed.
+func GrantedScopes() ([]string, error) {
+	b, err := readDataFile(appdir, scopesName)
+	if err == ErrNotLoggedIn {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(b)), nil
+}
+
+// MissingScopes returns the permissions the app asks for that the saved
+// token wasn't granted. When that isn't known it assumes nothing is
+// missing.
+func MissingScopes() ([]string, error) {
+	granted, err := GrantedScopes()
+	if err != nil || granted == nil {
+		return nil, err
+	}
+	return missingScopes(granted), nil
+}
+
+// missingScopes returns the permissions the app asks for that weren't
+// in granted.
+func missingScopes(granted []string) []string {
+	have := make(map[string]bool, len(granted))
+	for _, s := range granted {
+		have[s] = true
+	}
+	var missing []string
+	for _, s := range permissions {
+		if !have[s] {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
+// savingTokenSource saves every new token its source hands out, so a
+// token refreshed in the middle of a command isn't lost when it exits.
+// Requests can be made concurrently, hence the lock.
+type savingTokenSource struct {
+	mu   sync.Mutex
+	src  oauth2.TokenSource
+	last string
+	save func(*oauth2.Token) error
+}
+
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tok, err := s.src.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok.AccessToken != s.last {
+		s.last = tok.AccessToken
+		glog.Debug("saving refreshed token, expires %s", tok.Expiry)
+		if err := s.save(tok); err != nil {
+			glog.Log("couldn't save refreshed token: %s", err)
+		}
+	}
+	return tok, nil
+}
+
+// httpContext is the context token requests are made with, sending
+// them through a fetch.Transport like everything else.
+func httpContext() context.Context {
+	base := &http.Client{Transport: fetch.NewTransport(http.DefaultTransport)}
+	return context.WithValue(context.Background(), oauth2.HTTPClient, base)
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// tokenServer hands out a new access token for every refresh, granted
+// scope.
+func tokenServer(t *testing.T, scope string) (*httptest.Server, *int) {
+	refreshes := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		assert.Equal(t, "refresh_token", r.Form.Get("grant_type"))
+		assert.Equal(t, "refreshtoken", r.Form.Get("refresh_token"))
+		refreshes++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"access%d","token_type":"Bearer","expires_in":3600,"scope":%q}`, refreshes, scope)
+	}))
+	return srv, &refreshes
+}
+
+func useTokenServer(srv *httptest.Server) func() {
+	old := tokenURL
+	tokenURL = srv.URL
+	return func() {
+		tokenURL = old
+		srv.Close()
+	}
+}
+
+func TestRefreshTokenBeforeExpiry(t *testing.T) {
+	srv, refreshes := tokenServer(t, strings.Join(permissions, " "))
+	defer useTokenServer(srv)()
+
+	tok := testToken()
+	assert.False(t, needsRefresh(tok))
+	tok.Expiry = time.Now().Add(time.Minute)
+	assert.True(t, needsRefresh(tok))
+
+	newtok, err := refreshToken(tok)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, *refreshes)
+	assert.Equal(t, "access1", newtok.AccessToken)
+	// spotify doesn't always send a new refresh token, the old one stays
+	assert.Equal(t, "refreshtoken", newtok.RefreshToken)
+	assert.True(t, newtok.Expiry.After(tok.Expiry))
+}
+
+func TestPersistTokenRecordsScopes(t *testing.T) {
+	srv, _ := tokenServer(t, "user-read-private user-library-read")
+	defer useTokenServer(srv)()
+	defer Logout()
+
+	forgetScopes()
+	granted, err := GrantedScopes()
+	assert.NoError(t, err)
+	assert.Nil(t, granted)
+	missing, err := MissingScopes()
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+
+	tok, err := refreshToken(testToken())
+	assert.NoError(t, err)
+	assert.NoError(t, persistToken(tok))
+
+	saved, err := loadToken()
+	assert.NoError(t, err)
+	assert.Equal(t, tok.AccessToken, saved.AccessToken)
+	granted, err = GrantedScopes()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user-read-private", "user-library-read"}, granted)
+	missing, err = MissingScopes()
+	assert.NoError(t, err)
+	assert.Contains(t, missing, "playlist-modify-private")
+	assert.NotContains(t, missing, "user-read-private")
+
+	// a token with no scope in it, like one that was imported, leaves
+	// the record alone
+	assert.NoError(t, persistToken(testToken()))
+	granted, _ = GrantedScopes()
+	assert.Len(t, granted, 2)
+
+	assert.NoError(t, Logout())
+	granted, _ = GrantedScopes()
+	assert.Nil(t, granted)
+}
+
+func TestMissingScopes(t *testing.T) {
+	assert.Empty(t, missingScopes(permissions))
+	assert.Equal(t, permissions, missingScopes(nil))
+	assert.Equal(t, permissions[1:], missingScopes(permissions[:1]))
+}
+
+func TestSavingTokenSourceSavesNewTokens(t *testing.T) {
+	var saved []string
+	tokens := []*oauth2.Token{
+		{AccessToken: "one"},
+		{AccessToken: "one"},
+		{AccessToken: "two"},
+		{AccessToken: "two"},
+	}
+	src := &savingTokenSource{
+		src: tokenSourceFunc(func() (*oauth2.Token, error) {
+			tok := tokens[0]
+			tokens = tokens[1:]
+			return tok, nil
+		}),
+		last: "one",
+		save: func(tok *oauth2.Token) error {
+			saved = append(saved, tok.AccessToken)
+			return nil
+		},
+	}
+	for i := 0; i < 4; i++ {
+		_, err := src.Token()
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"two"}, saved)
+}
+
+func TestClientForSavesToItsApp(t *testing.T) {
+	srv, _ := tokenServer(t, "user-read-private")
+	defer useTokenServer(srv)()
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer access1", r.Header.Get("Authorization"))
+	}))
+	defer api.Close()
+
+	other := appdir.Sub("profiles/refreshing")
+	_, _, err := ClientFor(other)
+	assert.Equal(t, ErrNotLoggedIn, err)
+
+	s, err := storeFor(other)
+	assert.NoError(t, err)
+	expired := testToken()
+	expired.Expiry = time.Now().Add(-time.Hour)
+	assert.NoError(t, s.Save(expired))
+	defer s.Remove()
+
+	_, tok, err := ClientFor(other)
+	assert.NoError(t, err)
+	assert.Equal(t, "accesstoken", tok.AccessToken)
+
+	resp, err := savingClientFor(other, s, tok).Get(api.URL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	_, tok, err = ClientFor(other)
+	assert.NoError(t, err)
+	assert.Equal(t, "access1", tok.AccessToken)
+	b, err := readDataFile(other, scopesName)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-read-private", string(b))
+
+	// and none of it ended up in this run's directories
+	_, err = loadToken()
+	assert.Equal(t, ErrNotLoggedIn, err)
+}
+
+type tokenSourceFunc func() (*oauth2.Token, error)
+
+func (f tokenSourceFunc) Token() (*oauth2.Token, error) { return f() }
@@ -0,0 +1,335 @@
+package auth
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/brianloveswords/spotify/config"
+	"github.com/brianloveswords/spotify/xdg"
+	"golang.org/x/oauth2"
+)
+
+// TokenStore keeps the OAuth token between runs.
+type TokenStore interface {
+	// Load returns the saved token, or ErrNotLoggedIn if there isn't
+	// one.
+	Load() (*oauth2.Token, error)
+	// Save replaces the saved token with tok.
+	Save(tok *oauth2.Token) error
+	// Remove deletes the saved token, returning ErrNotLoggedIn if there
+	// wasn't one.
+	Remove() error
+}
+
+// TokenStoreEnv overrides the token_store setting.
+const TokenStoreEnv = "SPOTIFY_TOKEN_STORE"
+
+// NewTokenStore returns the store for app's token picked by the
+// token_store setting:
+//
+//	file         encrypted file with a random key next to it (default)
+//	passphrase   encrypted file with a key derived from a passphrase
+//	pass         the pass password manager
+//	secret-tool  the desktop keyring, through libsecret's secret-tool
+//	command      the commands in token_command_load, token_command_save
+//	             and token_command_remove
+func NewTokenStore(app *xdg.App, c config.Config) (TokenStore, error) {
+	switch kind := c.Get("token_store", TokenStoreEnv); kind {
+	case "", "file":
+		if app == appdir {
+			// share the key fileStore may have already read
+			return fileStore, nil
+		}
+		return newFileStore(app), nil
+	case "passphrase":
+		return NewPassphraseStore(app, passphraseTokenName, promptPassphrase), nil
+	case "pass":
+		return passStore(app), nil
+	case "secret-tool":
+		return secretToolStore(app), nil
+	case "command":
+		store := &CommandStore{
+			LoadCmd:   c["token_command_load"],
+			SaveCmd:   c["token_command_save"],
+			RemoveCmd: c["token_command_remove"],
+		}
+		if store.LoadCmd == "" || store.SaveCmd == "" {
+			return nil, fmt.Errorf("token_store = command needs token_command_load and token_command_save")
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown token_store %q, expected file, passphrase, pass, secret-tool or command", kind)
+	}
+}
+
+// UseApp keeps the token and config in app's directories from now on,
+// for switching profiles. It has to be called before anything loads the
+// token.
+func UseApp(app *xdg.App) {
+	appdir = app
+	fileStore = newFileStore(app)
+	store = nil
+}
+
+// store is the token store for this run, see tokenStore.
+var store TokenStore
+
+func tokenStore() TokenStore {
+	if store != nil {
+		return store
+	}
+	s, err := storeFor(appdir)
+	if err != nil {
+		glog.Fatal("%s", err)
+	}
+	store = s
+	return store
+}
+
+// storeFor reads app's config to find out where its token is kept.
+func storeFor(app *xdg.App) (TokenStore, error) {
+	c, err := config.Load(app)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read config: %s", err)
+	}
+	return NewTokenStore(app, c)
+}
+
+var fileStore = newFileStore(appdir)
+
+func newFileStore(app *xdg.App) *FileStore {
+	return &FileStore{App: app, Name: tokenName, KeyName: keyName}
+}
+
+// FileStore keeps the token encrypted in a file in the data directory,
+// with a random key in another file next to it. That keeps the token
+// out of anything that only gets the token file, like a sync of that one
+// file, but not away from anyone who can read the whole directory.
+type FileStore struct {
+	App     *xdg.App
+	Name    string
+	KeyName string
+
+	cachedKey []byte
+}
+
+func (f *FileStore) Load() (*oauth2.Token, error) {
+	buf, err := readDataFile(f.App, f.Name)
+	if err == ErrNotLoggedIn {
+		return nil, err
+	}
+	if err != nil {
+		return nil, tokenError(TokenUnreadable, err)
+	}
+	key, err := f.key()
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := unseal(key, buf)
+	if err != nil {
+		if tok := f.migrate(buf); tok != nil {
+			return tok, nil
+		}
+		return nil, err
+	}
+	return decodeToken(b)
+}
+
+func (f *FileStore) Save(tok *oauth2.Token) error {
+	key, err := f.key()
+	if IsTokenError(err, TokenCorrupt) || IsTokenError(err, TokenUnreadable) {
+		// whatever was encrypted with the broken key is being replaced
+		// anyway, so start over with a new one
+		key, err = f.replaceKey()
+	}
+	if err != nil {
+		return err
+	}
+	b, err := encodeToken(tok)
+	if err != nil {
+		return err
+	}
+	sealed, err := seal(key, b)
+	if err != nil {
+		return err
+	}
+	return withLock(f.App, f.Name, func() error {
+		return writeDataFile(f.App, f.Name, sealed)
+	})
+}
+
+// Remove deletes the token and its key, so a key that's gone bad
+// doesn't outlive logging out.
+func (f *FileStore) Remove() error {
+	err := withLock(f.App, f.Name, func() error {
+		return removeDataFile(f.App, f.Name)
+	})
+	keyErr := withLock(f.App, f.KeyName, func() error {
+		f.cachedKey = nil
+		return removeDataFile(f.App, f.KeyName)
+	})
+	if err == nil && keyErr != ErrNotLoggedIn {
+		err = keyErr
+	}
+	return err
+}
+
+// key returns the key tokens are encrypted with, making one the first
+// time it's needed.
+func (f *FileStore) key() ([]byte, error) {
+	if f.cachedKey != nil {
+		return f.cachedKey, nil
+	}
+	key, err := f.readKey()
+	if err != ErrNotLoggedIn {
+		f.cachedKey = key
+		return key, err
+	}
+
+	// another process may be making one at the same time, and the
+	// loser's token would be encrypted with a key that's gone
+	err = withLock(f.App, f.KeyName, func() error {
+		if key, err = f.readKey(); err != ErrNotLoggedIn {
+			return err
+		}
+		key, err = f.newKey()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.cachedKey = key
+	return key, nil
+}
+
+// replaceKey moves a key file that can't be used out of the way, to
+// KeyName.bad, and makes a new key in its place.
+func (f *FileStore) replaceKey() ([]byte, error) {
+	var key []byte
+	err := withLock(f.App, f.KeyName, func() error {
+		var err error
+		key, err = f.readKey()
+		switch {
+		case err == nil:
+			// someone else replaced it already
+			return nil
+		case err != ErrNotLoggedIn:
+			bad := f.KeyName + ".bad"
+			if err := f.App.DataRename(f.KeyName, bad); err != nil {
+				return fmt.Errorf("couldn't move token key aside: %s", err)
+			}
+			glog.Log("the token key was unusable, moved it to %s and made a new one", bad)
+		}
+		key, err = f.newKey()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.cachedKey = key
+	return key, nil
+}
+
+// newKey makes a random key and saves it. Callers hold the key's lock.
+func (f *FileStore) newKey() ([]byte, error) {
+	key, err := randomBytes(32)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeDataFile(f.App, f.KeyName, key); err != nil {
+		return nil, fmt.Errorf("couldn't save token key: %s", err)
+	}
+	return key, nil
+}
+
+// readKey reads the key file, returning ErrNotLoggedIn if there isn't
+// one yet.
+func (f *FileStore) readKey() ([]byte, error) {
+	key, err := readDataFile(f.App, f.KeyName)
+	if err == ErrNotLoggedIn {
+		return nil, err
+	}
+	if err != nil {
+		return nil, tokenError(TokenUnreadable, fmt.Errorf("couldn't read key: %s", err))
+	}
+	if len(key) != 32 {
+		return nil, tokenError(TokenCorrupt, fmt.Errorf("key is %d bytes, should be 32", len(key)))
+	}
+	return key, nil
+}
+
+// migrate tries to read a token saved with the legacy key and saves it
+// again with the current one.
+func (f *FileStore) migrate(buf []byte) *oauth2.Token {
+	key, err := legacyKey()
+	if err != nil {
+		glog.Debug("can't migrate token: %s", err)
+		return nil
+	}
+	b, err := unseal(key, buf)
+	if err != nil {
+		return nil
+	}
+	tok, err := decodeToken(b)
+	if err != nil {
+		return nil
+	}
+	glog.Verbose("re-encrypting token with the new key")
+	if err := f.Save(tok); err != nil {
+		glog.Log("couldn't save migrated token: %s", err)
+	}
+	return tok
+}
+
+// readDataFile returns the contents of a file in the data directory, or
+// ErrNotLoggedIn if it doesn't exist.
+func readDataFile(app *xdg.App, name string) ([]byte, error) {
+	f, err := app.DataOpen(name)
+	if os.IsNotExist(err) {
+		return nil, ErrNotLoggedIn
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ioutil.ReadAll(f)
+}
+
+// writeDataFile replaces a file in the data directory with b, without
+// ever leaving a partly written file behind.
+func writeDataFile(app *xdg.App, name string, b []byte) error {
+	return app.DataWriteAtomic(name, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
+
+// withLock runs fn holding the lock name in app's runtime directory.
+func withLock(app *xdg.App, name string, fn func() error) error {
+	unlock, err := app.Lock(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fn()
+}
+
+func removeDataFile(app *xdg.App, name string) error {
+	err := app.DataRemove(name)
+	if os.IsNotExist(err) {
+		return ErrNotLoggedIn
+	}
+	return err
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/brianloveswords/spotify/xdg"
+
+	"golang.org/x/oauth2"
+)
+
+// CommandStore hands the token to external commands, like a password
+// manager. The token is passed as JSON: printed to stdout by LoadCmd,
+// and written to the stdin of SaveCmd. Commands are run with sh -c.
+type CommandStore struct {
+	LoadCmd   string
+	SaveCmd   string
+	RemoveCmd string
+}
+
+// passStore keeps app's token in pass, at spotify-cli/oauth-token for
+// the default profile and under spotify-cli/profiles for the others.
+func passStore(app *xdg.App) *CommandStore {
+	entry := path.Join(app.App, tokenName)
+	return &CommandStore{
+		LoadCmd:   "pass show " + entry,
+		SaveCmd:   "pass insert --multiline --force " + entry,
+		RemoveCmd: "pass rm --force " + entry,
+	}
+}
+
+// secretToolStore keeps app's token in the keyring, under a service
+// named like app's directories.
+func secretToolStore(app *xdg.App) *CommandStore {
+	service := shellQuote(app.App)
+	return &CommandStore{
+		LoadCmd:   "secret-tool lookup service " + service,
+		SaveCmd:   "secret-tool store --label=" + shellQuote(app.App+" token") + " service " + service,
+		RemoveCmd: "secret-tool clear service " + service,
+	}
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func (c *CommandStore) Load() (*oauth2.Token, error) {
+	out, err := runCommand(c.LoadCmd, nil)
+	if _, ok := err.(*exec.ExitError); ok && len(bytes.TrimSpace(out)) == 0 {
+		// password managers generally fail without printing anything
+		// when there's no such entry
+		return nil, ErrNotLoggedIn
+	}
+	if err != nil {
+		return nil, tokenError(TokenUnreadable, fmt.Errorf("%s: %s", c.LoadCmd, err))
+	}
+	if len(bytes.TrimSpace(out)) == 0 {
+		return nil, ErrNotLoggedIn
+	}
+	tok := new(oauth2.Token)
+	if err := json.Unmarshal(bytes.TrimSpace(out), tok); err != nil {
+		return nil, tokenError(TokenCorrupt, fmt.Errorf("couldn't parse output of %s: %s", c.LoadCmd, err))
+	}
+	return tok, nil
+}
+
+func (c *CommandStore) Save(tok *oauth2.Token) error {
+	b, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	if _, err := runCommand(c.SaveCmd, append(b, '\n')); err != nil {
+		return fmt.Errorf("%s: %s", c.SaveCmd, err)
+	}
+	return nil
+}
+
+func (c *CommandStore) Remove() error {
+	if c.RemoveCmd == "" {
+		return fmt.Errorf("no command to remove the token, set token_command_remove")
+	}
+	if _, err := runCommand(c.RemoveCmd, nil); err != nil {
+		return fmt.Errorf("%s: %s", c.RemoveCmd, err)
+	}
+	return nil
+}
+
+// runCommand runs command through the shell, feeding it stdin if given,
+// and returns what it printed. Whatever it printed to stderr is logged
+// when debugging.
+func runCommand(command string, stdin []byte) ([]byte, error) {
+	glog.Debug("running %s", command)
+	cmd := exec.Command("sh", "-c", command)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		glog.Debug("%s: %s", command, msg)
+	}
+	return out, err
+}
@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/brianloveswords/spotify/xdg"
+	"golang.org/x/oauth2"
+)
+
+// PassphraseEnv supplies the passphrase for the passphrase store, for
+// when there's nobody around to type it.
+const PassphraseEnv = "SPOTIFY_TOKEN_PASSPHRASE"
+
+var passphraseTokenName = "oauth-token-passphrase"
+
+// PassphraseStore keeps the token encrypted in a file in the data
+// directory with a key derived from a passphrase. Each save uses a new
+// random salt, stored at the start of the file.
+type PassphraseStore struct {
+	App  *xdg.App
+	Name string
+	// Passphrase asks for the passphrase. It's only called once per
+	// run.
+	Passphrase func() (string, error)
+
+	passphrase *string
+}
+
+// NewPassphraseStore returns a store that keeps the token in the data
+// file name, asking for the passphrase with ask.
+func NewPassphraseStore(app *xdg.App, name string, ask func() (string, error)) *PassphraseStore {
+	return &PassphraseStore{App: app, Name: name, Passphrase: ask}
+}
+
+// saltedToken is what's in a passphrase store file.
+type saltedToken struct {
+	Salt   []byte
+	Sealed []byte
+}
+
+func (p *PassphraseStore) Load() (*oauth2.Token, error) {
+	buf, err := readDataFile(p.App, p.Name)
+	if err == ErrNotLoggedIn {
+		return nil, err
+	}
+	if err != nil {
+		return nil, tokenError(TokenUnreadable, err)
+	}
+	var salted saltedToken
+	if err := gob.NewDecoder(bytes.NewReader(buf)).Decode(&salted); err != nil {
+		return nil, tokenError(TokenCorrupt, err)
+	}
+	key, err := p.key(salted.Salt)
+	if err != nil {
+		return nil, err
+	}
+	b, err := unseal(key, salted.Sealed)
+	if err != nil {
+		// forget it so the next attempt asks again
+		p.passphrase = nil
+		if IsTokenError(err, TokenWrongKey) {
+			return nil, tokenError(TokenWrongKey, fmt.Errorf("wrong passphrase?"))
+		}
+		return nil, err
+	}
+	return decodeToken(b)
+}
+
+func (p *PassphraseStore) Save(tok *oauth2.Token) error {
+	salt, err := randomBytes(16)
+	if err != nil {
+		return err
+	}
+	key, err := p.key(salt)
+	if err != nil {
+		return err
+	}
+	b, err := encodeToken(tok)
+	if err != nil {
+		return err
+	}
+	sealed, err := seal(key, b)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(saltedToken{salt, sealed}); err != nil {
+		return err
+	}
+	return withLock(p.App, p.Name, func() error {
+		return writeDataFile(p.App, p.Name, buf.Bytes())
+	})
+}
+
+func (p *PassphraseStore) Remove() error {
+	return withLock(p.App, p.Name, func() error {
+		return removeDataFile(p.App, p.Name)
+	})
+}
+
+func (p *PassphraseStore) key(salt []byte) ([]byte, error) {
+	if p.passphrase == nil {
+		passphrase, err := p.Passphrase()
+		if err != nil {
+			return nil, err
+		}
+		if passphrase == "" {
+			return nil, fmt.Errorf("empty passphrase")
+		}
+		p.passphrase = &passphrase
+	}
+	return deriveKey(*p.passphrase, string(salt))
+}
+
+// ttyPath is the terminal the passphrase is asked for on.
+var ttyPath = "/dev/tty"
+
+// promptPassphrase gets the passphrase from SPOTIFY_TOKEN_PASSPHRASE, or
+// failing that asks for it on the terminal. It never reads stdin, which
+// might be a token being piped to import.
+func promptPassphrase() (string, error) {
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return passphrase, nil
+	}
+	if glog.IsLevelSilent() {
+		return "", fmt.Errorf("can't ask for the token passphrase when --silent, set %s", PassphraseEnv)
+	}
+	tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("can't ask for the token passphrase without a terminal, set %s", PassphraseEnv)
+	}
+	defer tty.Close()
+
+	glog.Prompt("token passphrase")
+
+	// turn off echo while it's typed, if this is a terminal
+	if err := stty(tty, "-echo"); err == nil {
+		defer func() {
+			stty(tty, "echo")
+			glog.Log("")
+		}()
+	}
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	line = strings.TrimRight(line, "\r\n")
+	if err != nil && line == "" {
+		return "", fmt.Errorf("couldn't read passphrase: %s", err)
+	}
+	return line, nil
+}
+
+func stty(tty *os.File, arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = tty
+	return cmd.Run()
+}
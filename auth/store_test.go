@@ -0,0 +1,166 @@
+package auth
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brianloveswords/spotify/config"
+	"github.com/brianloveswords/spotify/xdg"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func testToken() *oauth2.Token {
+	return &oauth2.Token{
+		AccessToken:  "accesstoken",
+		TokenType:    "Bearer",
+		RefreshToken: "refreshtoken",
+		Expiry:       time.Now().Add(time.Hour).Round(time.Second),
+	}
+}
+
+func memApp() *xdg.App {
+	app := &xdg.App{Home: "/home/test", App: "store-test", AppFs: afero.NewMemMapFs()}
+	app.MakeDirs()
+	return app
+}
+
+// testStore checks the behaviour every TokenStore should have.
+func testStore(t *testing.T, s TokenStore) {
+	_, err := s.Load()
+	assert.Equal(t, ErrNotLoggedIn, err)
+
+	tok := testToken()
+	assert.NoError(t, s.Save(tok))
+	tok2, err := s.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, tok.AccessToken, tok2.AccessToken)
+	assert.Equal(t, tok.RefreshToken, tok2.RefreshToken)
+	assert.True(t, tok.Expiry.Equal(tok2.Expiry))
+
+	assert.NoError(t, s.Remove())
+	_, err = s.Load()
+	assert.Equal(t, ErrNotLoggedIn, err)
+}
+
+func TestFileStore(t *testing.T) {
+	testStore(t, &FileStore{App: memApp(), Name: "token", KeyName: "key"})
+}
+
+func TestFileStoreRemoveWhenLoggedOut(t *testing.T) {
+	s := &FileStore{App: memApp(), Name: "token", KeyName: "key"}
+	assert.Equal(t, ErrNotLoggedIn, s.Remove())
+}
+
+func TestPassphraseStore(t *testing.T) {
+	asked := 0
+	ask := func() (string, error) {
+		asked++
+		return "correct horse", nil
+	}
+	app := memApp()
+	testStore(t, NewPassphraseStore(app, "token", ask))
+	assert.Equal(t, 1, asked)
+}
+
+func TestPassphraseStoreSaltsEachSave(t *testing.T) {
+	app := memApp()
+	s := NewPassphraseStore(app, "token", func() (string, error) { return "pw", nil })
+	read := func() []byte {
+		b, err := readDataFile(app, "token")
+		assert.NoError(t, err)
+		return b
+	}
+
+	assert.NoError(t, s.Save(testToken()))
+	first := read()
+	assert.NoError(t, s.Save(testToken()))
+	assert.False(t, bytes.Equal(first, read()))
+}
+
+func TestPassphraseStoreWrongPassphrase(t *testing.T) {
+	app := memApp()
+	assert.NoError(t, NewPassphraseStore(app, "token", func() (string, error) { return "right", nil }).Save(testToken()))
+
+	_, err := NewPassphraseStore(app, "token", func() (string, error) { return "wrong", nil }).Load()
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrNotLoggedIn, err)
+
+	_, err = NewPassphraseStore(app, "token", func() (string, error) { return "", nil }).Load()
+	assert.Error(t, err)
+}
+
+func TestCommandStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "command-store")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "token")
+
+	testStore(t, &CommandStore{
+		LoadCmd:   fmt.Sprintf("cat %q", file),
+		SaveCmd:   fmt.Sprintf("cat > %q", file),
+		RemoveCmd: fmt.Sprintf("rm %q", file),
+	})
+
+	s := &CommandStore{LoadCmd: "echo not json", SaveCmd: "false"}
+	_, err = s.Load()
+	assert.Error(t, err)
+	assert.NotEqual(t, ErrNotLoggedIn, err)
+	assert.Error(t, s.Save(testToken()))
+	assert.Error(t, s.Remove())
+}
+
+func TestNewTokenStore(t *testing.T) {
+	for setting, expect := range map[string]TokenStore{
+		"":            fileStore,
+		"file":        fileStore,
+		"pass":        passStore(appdir),
+		"secret-tool": secretToolStore(appdir),
+	} {
+		s, err := NewTokenStore(appdir, config.Config{"token_store": setting})
+		assert.NoError(t, err, setting)
+		assert.Equal(t, expect, s, setting)
+	}
+
+	s, err := NewTokenStore(appdir, config.Config{"token_store": "passphrase"})
+	assert.NoError(t, err)
+	assert.IsType(t, &PassphraseStore{}, s)
+
+	s, err = NewTokenStore(appdir, config.Config{
+		"token_store":        "command",
+		"token_command_load": "load",
+		"token_command_save": "save",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &CommandStore{LoadCmd: "load", SaveCmd: "save"}, s)
+
+	_, err = NewTokenStore(appdir, config.Config{"token_store": "command"})
+	assert.Error(t, err)
+	_, err = NewTokenStore(appdir, config.Config{"token_store": "keychain"})
+	assert.Error(t, err)
+}
+
+func TestStoresAreKeptPerApp(t *testing.T) {
+	other := appdir.Sub("profiles/other")
+	other.MakeDirs()
+
+	s, err := NewTokenStore(other, config.Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, other, s.(*FileStore).App)
+
+	assert.Equal(t, "pass show spotify-cli/oauth-token", passStore(appdir).LoadCmd)
+	assert.Equal(t, "pass show spotify-cli/profiles/other/oauth-token", passStore(other).LoadCmd)
+	assert.Equal(t, "secret-tool lookup service 'spotify-cli/profiles/other'", secretToolStore(other).LoadCmd)
+
+	assert.NoError(t, s.Save(testToken()))
+	_, tok, err := ClientFor(other)
+	assert.NoError(t, err)
+	assert.Equal(t, "accesstoken", tok.AccessToken)
+	assert.NoError(t, s.Remove())
+}
@@ -1,17 +1,15 @@
 package auth
 
-// TODO: remove all the panics and actually handle errors, or do better logging
-
 import (
 	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"encoding/gob"
+	"fmt"
 	"io"
 
 	"github.com/brianloveswords/spotify/xdg"
-	"github.com/lpabon/godbc"
 	"golang.org/x/crypto/scrypt"
 	"golang.org/x/oauth2"
 )
@@ -23,111 +21,152 @@ type encrypted struct {
 
 var appdir = xdg.NewApp("spotify-cli")
 var tokenName = "oauth-token"
+var keyName = "token-key"
 
-func getKey() []byte {
-	id, secret := clientID, clientSecret
-	dk, err := scrypt.Key([]byte(secret), []byte(id), 32768, 8, 1, 32)
-	if err != nil {
-		panic(err)
+// TokenError is why a saved token couldn't be used.
+type TokenError struct {
+	Kind TokenErrorKind
+	Err  error
+}
+
+// TokenErrorKind says what went wrong with a saved token.
+type TokenErrorKind int
+
+const (
+	// TokenCorrupt means the token isn't something we saved, or was
+	// cut short.
+	TokenCorrupt TokenErrorKind = iota + 1
+	// TokenWrongKey means the token didn't decrypt: it was saved with
+	// a different key or passphrase, or tampered with. Encryption can't
+	// tell those apart.
+	TokenWrongKey
+	// TokenUnreadable means the token or its key couldn't be read at
+	// all.
+	TokenUnreadable
+)
+
+func (k TokenErrorKind) String() string {
+	switch k {
+	case TokenCorrupt:
+		return "token is corrupt"
+	case TokenWrongKey:
+		return "token was encrypted with a different key"
+	case TokenUnreadable:
+		return "token couldn't be read"
+	}
+	return "token error"
+}
+
+func (e *TokenError) Error() string {
+	if e.Err == nil {
+		return e.Kind.String()
+	}
+	return fmt.Sprintf("%s: %s", e.Kind, e.Err)
+}
+
+func tokenError(kind TokenErrorKind, err error) error {
+	return &TokenError{Kind: kind, Err: err}
+}
+
+// IsTokenError reports whether err is a TokenError of kind, or of any
+// kind if kind is 0.
+func IsTokenError(err error, kind TokenErrorKind) bool {
+	e, ok := err.(*TokenError)
+	return ok && (kind == 0 || e.Kind == kind)
+}
+
+// legacyKey is the key tokens were encrypted with before there was a
+// key file, kept around to migrate them.
+func legacyKey() ([]byte, error) {
+	if clientSecret == "" {
+		return nil, fmt.Errorf("no client secret to derive the old key from")
 	}
-	return dk
+	return deriveKey(clientSecret, clientID)
 }
-func encryptToken(tok *oauth2.Token) []byte {
-	// turn token to bytes, then feed to encrypt
+
+func deriveKey(password, salt string) ([]byte, error) {
+	return scrypt.Key([]byte(password), []byte(salt), 32768, 8, 1, 32)
+}
+
+func encodeToken(tok *oauth2.Token) ([]byte, error) {
 	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	if err := enc.Encode(tok); err != nil {
-		panic(err.Error())
+	if err := gob.NewEncoder(&buf).Encode(tok); err != nil {
+		return nil, fmt.Errorf("couldn't encode token: %s", err)
 	}
-	out := encrypt(buf.Bytes())
-	godbc.Ensure(len(out) > 0, "didn't create out bytes")
-	return out
+	return buf.Bytes(), nil
 }
 
-func decryptToken(b []byte) *oauth2.Token {
-	buf := bytes.NewBuffer(decrypt(b))
-	dec := gob.NewDecoder(buf)
+func decodeToken(b []byte) (*oauth2.Token, error) {
 	tok := new(oauth2.Token)
-	if err := dec.Decode(tok); err != nil {
-		panic(err.Error())
+	if err := gob.NewDecoder(bytes.NewBuffer(b)).Decode(tok); err != nil {
+		return nil, tokenError(TokenCorrupt, err)
 	}
-	return tok
+	return tok, nil
 }
 
-func encrypt(b []byte) []byte {
-	godbc.Require(len(b) > 0, "input length must be > 0")
-
-	block, err := aes.NewCipher(getKey())
+// seal encrypts b with AES-GCM under key and gob encodes the result
+// along with the nonce.
+func seal(key, b []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
 	nonce := make([]byte, 12)
 	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		panic(err.Error())
+		return nil, err
 	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		panic(err.Error())
+		return nil, err
 	}
 	var buf bytes.Buffer
 	enc := gob.NewEncoder(&buf)
 	crypt := encrypted{gcm.Seal(nil, nonce, b, nil), nonce}
 	if err := enc.Encode(crypt); err != nil {
-		panic(err.Error())
+		return nil, err
 	}
-	out := buf.Bytes()
-	godbc.Ensure(len(out) > 0, "didn't create out bytes")
-	return out
+	return buf.Bytes(), nil
 }
 
-func decrypt(buf []byte) []byte {
-	godbc.Require(len(buf) > 0, "buf length must be > 0")
-
+// unseal reverses seal. Anything that isn't what seal writes is a
+// TokenCorrupt error, and anything that doesn't decrypt under key is a
+// TokenWrongKey error.
+func unseal(key, buf []byte) ([]byte, error) {
+	if len(buf) == 0 {
+		return nil, tokenError(TokenCorrupt, fmt.Errorf("empty"))
+	}
 	var crypt encrypted
 	dec := gob.NewDecoder(bytes.NewBuffer(buf))
 	if err := dec.Decode(&crypt); err != nil {
-		panic(err.Error())
+		return nil, tokenError(TokenCorrupt, err)
 	}
 
-	block, err := aes.NewCipher(getKey())
+	block, err := aes.NewCipher(key)
 	if err != nil {
-		panic(err.Error())
+		return nil, tokenError(TokenUnreadable, err)
 	}
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		panic(err.Error())
+		return nil, tokenError(TokenUnreadable, err)
+	}
+	if len(crypt.Nonce) != gcm.NonceSize() {
+		return nil, tokenError(TokenCorrupt, fmt.Errorf("bad nonce length %d", len(crypt.Nonce)))
 	}
 	plaintext, err := gcm.Open(nil, crypt.Nonce, crypt.Ciphertext, nil)
 	if err != nil {
-		panic(err.Error())
+		return nil, tokenError(TokenWrongKey, nil)
 	}
-	return plaintext
+	return plaintext, nil
 }
 
-func saveToken(tok *oauth2.Token) {
-	f, err := appdir.DataCreate(tokenName)
-	if err != nil {
-		panic(err.Error())
-	}
-	defer f.Close()
-	if _, err := f.Write(encryptToken(tok)); err != nil {
-		panic(err.Error())
-	}
+// saveToken saves tok in the token store.
+func saveToken(tok *oauth2.Token) error {
+	return tokenStore().Save(tok)
 }
 
-func loadToken() *oauth2.Token {
-	f, err := appdir.DataOpen(tokenName)
-	if err != nil {
-		// fuck it, just return nil
-		return nil
-	}
-	defer f.Close()
-	var buf bytes.Buffer
-	if _, err := io.Copy(&buf, f); err != nil {
-		panic(err.Error())
-	}
-
-	tok := decryptToken(buf.Bytes())
-	return tok
+// loadToken returns the token in the token store, ErrNotLoggedIn if
+// there isn't one, or a TokenError if it can't be used.
+func loadToken() (*oauth2.Token, error) {
+	return tokenStore().Load()
 }
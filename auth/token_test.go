@@ -1,7 +1,7 @@
 package auth
 
 import (
-	"os"
+	"io"
 	"testing"
 	"time"
 
@@ -9,30 +9,56 @@ import (
 	"golang.org/x/oauth2"
 )
 
-func TestBasicEncryption(t *testing.T) {
-	assert.Equal(t, []byte("hi"), decrypt(encrypt([]byte("hi"))))
+func TestSealUnseal(t *testing.T) {
+	key, err := randomBytes(32)
+	assert.NoError(t, err)
+	sealed, err := seal(key, []byte("hi"))
+	assert.NoError(t, err)
+	b, err := unseal(key, sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hi"), b)
+
+	other, err := randomBytes(32)
+	assert.NoError(t, err)
+	_, err = unseal(other, sealed)
+	assert.True(t, IsTokenError(err, TokenWrongKey), "got %v", err)
+
+	_, err = unseal(key, []byte("hi"))
+	assert.True(t, IsTokenError(err, TokenCorrupt), "got %v", err)
 }
 
-func TestEncryptDecryptToken(t *testing.T) {
+func TestFileStoreEncryptsToken(t *testing.T) {
 	tok := &oauth2.Token{
 		AccessToken:  "accesstoken",
 		TokenType:    "tokentype",
 		RefreshToken: "refreshtoken",
 		Expiry:       time.Now(),
 	}
+	s := &FileStore{App: memApp(), Name: "token", KeyName: "key"}
+	assert.NoError(t, s.Save(tok))
 
-	tok2 := decryptToken(encryptToken(tok))
+	b, err := readDataFile(s.App, s.Name)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "accesstoken")
+	assert.NotContains(t, string(b), "refreshtoken")
 
+	key, err := s.key()
+	assert.NoError(t, err)
+	plaintext, err := unseal(key, b)
+	assert.NoError(t, err)
+	tok2, err := decodeToken(plaintext)
+	assert.NoError(t, err)
 	assert.Equal(t, tok.AccessToken, tok2.AccessToken)
 	assert.Equal(t, tok.TokenType, tok2.TokenType)
 	assert.Equal(t, tok.RefreshToken, tok2.RefreshToken)
+
+	loaded, err := s.Load()
+	assert.NoError(t, err)
+	assert.Equal(t, tok.RefreshToken, loaded.RefreshToken)
 }
 
 func TestSaveAndLoadToken(t *testing.T) {
-	filename := "test-token"
-	defer func() {
-		os.Remove(filename)
-	}()
+	defer Logout()
 
 	tok := &oauth2.Token{
 		AccessToken:  "accesstoken",
@@ -41,10 +67,125 @@ func TestSaveAndLoadToken(t *testing.T) {
 		Expiry:       time.Now().Add(1 * time.Hour),
 	}
 
-	saveToken(tok, filename)
-	tok2 := loadToken(filename)
+	assert.NoError(t, saveToken(tok))
+	tok2, err := loadToken()
+	assert.NoError(t, err)
 
 	assert.Equal(t, tok.AccessToken, tok2.AccessToken)
 	assert.Equal(t, tok.TokenType, tok2.TokenType)
 	assert.Equal(t, tok.RefreshToken, tok2.RefreshToken)
 }
+
+func TestLoadTokenWhenLoggedOut(t *testing.T) {
+	Logout()
+	_, err := loadToken()
+	assert.Equal(t, ErrNotLoggedIn, err)
+}
+
+// saveTokenFile saves a token and returns what ended up in the file.
+func saveTokenFile(t *testing.T) []byte {
+	assert.NoError(t, saveToken(testToken()))
+	b, err := readDataFile(appdir, tokenName)
+	assert.NoError(t, err)
+	return b
+}
+
+func writeTokenFile(t *testing.T, b []byte) {
+	assert.NoError(t, writeDataFile(appdir, tokenName, b))
+}
+
+func TestLoadTamperedToken(t *testing.T) {
+	defer Logout()
+	b := saveTokenFile(t)
+
+	// flip a bit near the end, inside the ciphertext
+	b[len(b)-5] ^= 0x01
+	writeTokenFile(t, b)
+
+	_, err := loadToken()
+	assert.True(t, IsTokenError(err, TokenWrongKey), "%v", err)
+}
+
+func TestLoadTruncatedToken(t *testing.T) {
+	defer Logout()
+	b := saveTokenFile(t)
+
+	for _, n := range []int{0, 1, len(b) / 2, len(b) - 1} {
+		writeTokenFile(t, b[:n])
+		_, err := loadToken()
+		assert.True(t, IsTokenError(err, TokenCorrupt), "%d bytes: %v", n, err)
+	}
+}
+
+func TestLoadTokenWithAnotherKey(t *testing.T) {
+	defer Logout()
+	saveTokenFile(t)
+
+	other, err := randomBytes(32)
+	assert.NoError(t, err)
+	old := fileStore.cachedKey
+	fileStore.cachedKey = other
+	defer func() { fileStore.cachedKey = old }()
+
+	_, err = loadToken()
+	assert.True(t, IsTokenError(err, TokenWrongKey), "%v", err)
+}
+
+func TestLoadTokenWithCorruptKey(t *testing.T) {
+	defer Logout()
+	saveTokenFile(t)
+
+	old, err := fileStore.key()
+	assert.NoError(t, err)
+	defer func() {
+		writeDataFile(appdir, keyName, old)
+		fileStore.cachedKey = old
+	}()
+	assert.NoError(t, writeDataFile(appdir, keyName, old[:10]))
+	fileStore.cachedKey = nil
+
+	_, err = loadToken()
+	assert.True(t, IsTokenError(err, TokenCorrupt), "%v", err)
+}
+
+func TestSaveTokenReplacesCorruptKey(t *testing.T) {
+	defer Logout()
+	saveTokenFile(t)
+
+	old, err := fileStore.key()
+	assert.NoError(t, err)
+	assert.NoError(t, writeDataFile(appdir, keyName, old[:10]))
+	fileStore.cachedKey = nil
+	_, err = loadToken()
+	assert.True(t, IsTokenError(err, TokenCorrupt), "%v", err)
+
+	// what logging in again does
+	assert.NoError(t, persistToken(testToken()))
+	tok, err := loadToken()
+	assert.NoError(t, err)
+	assert.Equal(t, "accesstoken", tok.AccessToken)
+
+	bad, err := readDataFile(appdir, keyName+".bad")
+	assert.NoError(t, err)
+	assert.Equal(t, old[:10], bad)
+	appdir.DataRemove(keyName + ".bad")
+
+	// and a fresh process can read it with the new key
+	fileStore.cachedKey = nil
+	_, err = loadToken()
+	assert.NoError(t, err)
+}
+
+func TestLogoutRemovesKey(t *testing.T) {
+	saveTokenFile(t)
+	assert.NoError(t, Logout())
+	_, err := readDataFile(appdir, keyName)
+	assert.Equal(t, ErrNotLoggedIn, err)
+	assert.Nil(t, fileStore.cachedKey)
+}
+
+func TestTokenErrorMessages(t *testing.T) {
+	assert.Equal(t, "token was encrypted with a different key", tokenError(TokenWrongKey, nil).Error())
+	assert.Equal(t, "token is corrupt: unexpected EOF", (&TokenError{TokenCorrupt, io.ErrUnexpectedEOF}).Error())
+	assert.False(t, IsTokenError(ErrNotLoggedIn, 0))
+}
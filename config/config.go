@@ -0,0 +1,88 @@
+// Package config reads the settings file, ~/.config/spotify-cli/config.
+//
+// The file is one setting per line, like
+//
+//	# where to keep the login
+//	token_store = pass
+//
+// Blank lines and lines starting with # are ignored.
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/brianloveswords/spotify/logger"
+	"github.com/brianloveswords/spotify/xdg"
+)
+
+var glog = logger.DefaultLogger
+
+// Name is the name of the settings file in the app's config directory.
+const Name = "config"
+
+// Config maps setting names to values.
+type Config map[string]string
+
+// Load reads the settings file from app's config directory, or failing
+// that the first of the system config directories that has one. A
+// missing file is the same as an empty one.
+func Load(app *xdg.App) (Config, error) {
+	f, err := app.ConfigLookup(Name)
+	if os.IsNotExist(err) {
+		return Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parse reads settings in the format of the settings file.
+func Parse(r io.Reader) (Config, error) {
+	c := Config{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected name = value, got %q", n, line)
+		}
+		name := strings.TrimSpace(line[:i])
+		if name == "" {
+			return nil, fmt.Errorf("line %d: missing setting name", n)
+		}
+		c[name] = unquote(strings.TrimSpace(line[i+1:]))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Get returns the named setting, letting the environment variable env
+// override it when set. env can be empty for settings that only come
+// from the file.
+func (c Config) Get(name, env string) string {
+	if env != "" {
+		if v := os.Getenv(env); v != "" {
+			glog.Debug("config %s from $%s", name, env)
+			return v
+		}
+	}
+	return c[name]
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/brianloveswords/spotify/xdg"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	c, err := Parse(strings.NewReader(`
+# comment
+token_store = command
+token_command_load = "pass show spotify-cli/token"
+  empty =
+equals = a=b
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, Config{
+		"token_store":        "command",
+		"token_command_load": "pass show spotify-cli/token",
+		"empty":              "",
+		"equals":             "a=b",
+	}, c)
+
+	_, err = Parse(strings.NewReader("just words"))
+	assert.Error(t, err)
+	_, err = Parse(strings.NewReader("= value"))
+	assert.Error(t, err)
+}
+
+func TestGetPrefersEnv(t *testing.T) {
+	c := Config{"token_store": "file"}
+	assert.Equal(t, "file", c.Get("token_store", "CONFIG_TEST_TOKEN_STORE"))
+
+	os.Setenv("CONFIG_TEST_TOKEN_STORE", "pass")
+	defer os.Unsetenv("CONFIG_TEST_TOKEN_STORE")
+	assert.Equal(t, "pass", c.Get("token_store", "CONFIG_TEST_TOKEN_STORE"))
+	assert.Equal(t, "", c.Get("missing", ""))
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	app := &xdg.App{Home: "/home/test", App: "config-test", AppFs: afero.NewMemMapFs()}
+	c, err := Load(app)
+	assert.NoError(t, err)
+	assert.Empty(t, c)
+
+	f, _ := app.ConfigCreate(Name)
+	f.Write([]byte("token_store = pass\n"))
+	f.Close()
+	c, err = Load(app)
+	assert.NoError(t, err)
+	assert.Equal(t, "pass", c["token_store"])
+}
+
+func TestLoadFromSystemConfigDirs(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	app := &xdg.App{Home: "/home/test", App: "config-test", AppFs: fs, ConfigDirs: []string{"/etc/xdg"}}
+	afero.WriteFile(fs, "/etc/xdg/config-test/config", []byte("token_store = pass\n"), 0644)
+
+	c, err := Load(app)
+	assert.NoError(t, err)
+	assert.Equal(t, "pass", c["token_store"])
+
+	// the user's own file wins
+	f, _ := app.ConfigCreate(Name)
+	f.Write([]byte("token_store = file\n"))
+	f.Close()
+	c, err = Load(app)
+	assert.NoError(t, err)
+	assert.Equal(t, "file", c["token_store"])
+}
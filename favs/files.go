@@ -0,0 +1,31 @@
+package favs
+
+import (
+	"encoding/gob"
+	"io"
+)
+
+// writeAtomic is one of the xdg.App *WriteAtomic methods.
+type writeAtomic func(name string, write func(io.Writer) error) error
+
+// withLock runs fn holding the lock name in the app's runtime
+// directory, so two commands can't both load a file, change it and save
+// it, with the second losing the first's changes. Where more than one is
+// needed, take the library's, then the artist store's, then the review
+// queue's.
+func withLock(name string, fn func() error) error {
+	unlock, err := appdir.Lock(name)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return fn()
+}
+
+// saveGobAtomic gob-encodes v into name with write, so readers only ever
+// see a complete file.
+func saveGobAtomic(write writeAtomic, name string, v interface{}) error {
+	return write(name, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(v)
+	})
+}
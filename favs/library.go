@@ -0,0 +1,264 @@
+package favs
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/brianloveswords/spotify/fetch"
+	"github.com/brianloveswords/spotify/logger"
+	"github.com/zmb3/spotify"
+)
+
+// Library is the local copy of the saved tracks in the spotify library,
+// newest first like spotify returns them.
+type Library struct {
+	Version      int
+	Tracks       []spotify.SavedTrack
+	LastSync     time.Time
+	LastFullSync time.Time
+}
+
+// SyncResult describes what a Sync changed.
+type SyncResult struct {
+	Added   int
+	Removed int
+	Full    bool
+}
+
+const libraryVersion = 1
+
+var libraryName = "saved-tracks"
+
+// legacyLibraryFilename is where saved tracks used to be cached, as a
+// gob []spotify.SavedTrack in the working directory.
+var legacyLibraryFilename = "saved-tracks.data"
+
+// FullSyncInterval is how often Sync pages through the whole library
+// instead of just the newest tracks. Incremental syncs can't see tracks
+// that were removed, so this is how removals get noticed.
+var FullSyncInterval = 7 * 24 * time.Hour
+
+// libraryPageSize is the most saved tracks spotify returns per page.
+const libraryPageSize = 50
+
+// LoadLibrary reads the saved tracks from the cache directory. If there
+// isn't a cache yet it picks up the old saved-tracks.data file, if any.
+func LoadLibrary() (*Library, error) {
+	library := &Library{Version: libraryVersion}
+
+	f, err := appdir.CacheOpen(libraryName)
+	if os.IsNotExist(err) {
+		if err := library.migrateLegacy(legacyLibraryFilename); err != nil {
+			return nil, fmt.Errorf("couldn't migrate %s: %s", legacyLibraryFilename, err)
+		}
+		return library, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if err := gob.NewDecoder(f).Decode(library); err != nil {
+		return nil, fmt.Errorf("couldn't decode library cache: %s", err)
+	}
+	if library.Version != libraryVersion {
+		// it's only a cache, start over rather than migrating
+		glog.Verbose("library cache is version %d, wanted %d, starting over", library.Version, libraryVersion)
+		return &Library{Version: libraryVersion}, nil
+	}
+	return library, nil
+}
+
+func (l *Library) migrateLegacy(filename string) error {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := gob.NewDecoder(f).Decode(&l.Tracks); err != nil {
+		return err
+	}
+	glog.Verbose("migrating %d saved tracks from %s", len(l.Tracks), filename)
+	return nil
+}
+
+// Save writes the library to the cache directory.
+func (l *Library) Save() error {
+	return saveGobAtomic(appdir.CacheWriteAtomic, libraryName, l)
+}
+
+// SyncLibrary loads the library, brings it up to date with spotify and
+// saves it, holding the library's lock throughout so two syncs at once
+// don't undo each other. Usually it only fetches pages until it reaches
+// tracks it already knows about, but when full is true or the last full
+// sync is older than FullSyncInterval it fetches everything, which also
+// catches removals.
+func SyncLibrary(client LibraryClient, full bool) (*Library, SyncResult, error) {
+	defer glog.Enter("favs.SyncLibrary")()
+	fetchPage := func(ctx context.Context, offset, limit int) ([]spotify.SavedTrack, int, error) {
+		page, err := client.CurrentUsersTracksOpt(&spotify.Options{
+			Limit:  &limit,
+			Offset: &offset,
+		})
+		if err != nil {
+			return nil, 0, err
+		}
+		glog.Context(ctx).Debug("got %s", page.Endpoint)
+		return page.Tracks, page.Total, nil
+	}
+
+	var (
+		library *Library
+		result  SyncResult
+	)
+	err := withLock(libraryName, func() error {
+		var err error
+		if library, err = LoadLibrary(); err != nil {
+			return err
+		}
+		if result, err = library.sync(fetchPage, full, time.Now()); err != nil {
+			return err
+		}
+		return library.Save()
+	})
+	return library, result, err
+}
+
+// LibraryClient is the part of the spotify client that reads the
+// user's saved tracks.
+type LibraryClient interface {
+	CurrentUsersTracksOpt(opt *spotify.Options) (*spotify.SavedTrackPage, error)
+}
+
+// pageFunc fetches one page of saved tracks, returning the tracks and
+// the total number of tracks in the library. It logs through ctx, since
+// pages may be fetched concurrently.
+type pageFunc func(ctx context.Context, offset, limit int) ([]spotify.SavedTrack, int, error)
+
+func (l *Library) sync(fetchPage pageFunc, full bool, now time.Time) (result SyncResult, err error) {
+	full = full || len(l.Tracks) == 0 || now.Sub(l.LastFullSync) > FullSyncInterval
+	if full {
+		result, err = l.syncFull(fetchPage)
+		l.LastFullSync = now
+	} else {
+		result, err = l.syncIncremental(fetchPage)
+	}
+	if err != nil {
+		return result, err
+	}
+	l.LastSync = now
+	return result, nil
+}
+
+func (l *Library) syncFull(fetchPage pageFunc) (SyncResult, error) {
+	result := SyncResult{Full: true}
+
+	// the first page tells us how many there are, then the rest can be
+	// fetched all at once
+	first, total, err := fetchPage(context.Background(), 0, libraryPageSize)
+	if err != nil {
+		return result, fmt.Errorf("error getting tracks: %s", err)
+	}
+	npages := (total + libraryPageSize - 1) / libraryPageSize
+	pages := make([][]spotify.SavedTrack, npages)
+	if npages > 0 {
+		pages[0] = first
+	}
+	err = fetch.Map(context.Background(), npages-1, fetch.DefaultWorkers, func(ctx context.Context, i int) error {
+		offset := (i + 1) * libraryPageSize
+		ctx, done := glog.EnterContext(logger.WithFields(ctx, "offset", offset), "favs.fetchPage")
+		defer done()
+		page, _, err := fetchPage(ctx, offset, libraryPageSize)
+		pages[i+1] = page
+		return err
+	})
+	if err != nil {
+		return result, fmt.Errorf("error getting tracks: %s", err)
+	}
+
+	var tracks []spotify.SavedTrack
+	for _, page := range pages {
+		tracks = append(tracks, page...)
+	}
+
+	before := savedTrackKeys(l.Tracks)
+	after := savedTrackKeys(tracks)
+	for key := range after {
+		if !before[key] {
+			result.Added++
+		}
+	}
+	for key := range before {
+		if !after[key] {
+			result.Removed++
+		}
+	}
+
+	l.Tracks = tracks
+	return result, nil
+}
+
+func (l *Library) syncIncremental(fetchPage pageFunc) (SyncResult, error) {
+	var result SyncResult
+	known := savedTrackKeys(l.Tracks)
+
+	var added []spotify.SavedTrack
+	done := false
+	for offset := 0; !done; offset += libraryPageSize {
+		page, total, err := fetchPage(context.Background(), offset, libraryPageSize)
+		if err != nil {
+			return result, fmt.Errorf("error getting tracks: %s", err)
+		}
+		for _, track := range page {
+			// saved tracks come newest first, so once we see one we
+			// already have, everything after it is old news too
+			if known[savedTrackKey(track)] {
+				done = true
+				break
+			}
+			added = append(added, track)
+		}
+		if len(page) == 0 || offset+len(page) >= total {
+			done = true
+		}
+	}
+
+	if len(added) == 0 {
+		return result, nil
+	}
+
+	// a track that was removed and saved again shows up as new, so drop
+	// its old entry
+	readded := make(map[spotify.ID]bool)
+	for _, track := range added {
+		readded[track.ID] = true
+	}
+	tracks := added
+	for _, track := range l.Tracks {
+		if !readded[track.ID] {
+			tracks = append(tracks, track)
+		}
+	}
+
+	result.Added = len(added)
+	l.Tracks = tracks
+	return result, nil
+}
+
+func savedTrackKey(track spotify.SavedTrack) string {
+	return string(track.ID) + "@" + track.AddedAt
+}
+
+func savedTrackKeys(tracks []spotify.SavedTrack) map[string]bool {
+	keys := make(map[string]bool, len(tracks))
+	for _, track := range tracks {
+		keys[savedTrackKey(track)] = true
+	}
+	return keys
+}
@@ -0,0 +1,132 @@
+package favs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify"
+)
+
+func savedTrack(id string, addedAt string) spotify.SavedTrack {
+	track := spotify.SavedTrack{AddedAt: addedAt}
+	track.ID = spotify.ID(id)
+	return track
+}
+
+// fakeLibrary serves pages out of tracks and counts how many pages were
+// asked for.
+type fakeLibrary struct {
+	mu     sync.Mutex
+	tracks []spotify.SavedTrack
+	pages  int
+}
+
+func (f *fakeLibrary) fetch(ctx context.Context, offset, limit int) ([]spotify.SavedTrack, int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pages++
+	if offset >= len(f.tracks) {
+		return nil, len(f.tracks), nil
+	}
+	end := offset + limit
+	if end > len(f.tracks) {
+		end = len(f.tracks)
+	}
+	return f.tracks[offset:end], len(f.tracks), nil
+}
+
+func manyTracks(n int, day int) (tracks []spotify.SavedTrack) {
+	for i := 0; i < n; i++ {
+		tracks = append(tracks, savedTrack(fmt.Sprintf("t%d-%d", day, i), fmt.Sprintf("2018-07-%02dT00:00:00Z", day)))
+	}
+	return tracks
+}
+
+func trackIDs(tracks []spotify.SavedTrack) (ids []string) {
+	for _, track := range tracks {
+		ids = append(ids, string(track.ID))
+	}
+	return ids
+}
+
+func TestLibrarySyncIncremental(t *testing.T) {
+	now := time.Date(2018, 7, 10, 0, 0, 0, 0, time.UTC)
+	old := manyTracks(120, 1)
+	remote := &fakeLibrary{tracks: old}
+
+	library := &Library{Version: libraryVersion}
+	result, err := library.sync(remote.fetch, false, now)
+	assert.NoError(t, err)
+	assert.True(t, result.Full, "first sync is always full")
+	assert.Equal(t, 120, result.Added)
+	assert.Equal(t, 3, remote.pages)
+	assert.Equal(t, now, library.LastSync)
+	assert.Equal(t, now, library.LastFullSync)
+
+	// three new tracks, one of which was saved before and re-added
+	readded := savedTrack("t1-5", "2018-07-03T00:00:00Z")
+	fresh := append(manyTracks(2, 3), readded)
+	remote.tracks = append(append([]spotify.SavedTrack{}, fresh...), old...)
+	remote.pages = 0
+
+	later := now.Add(time.Hour)
+	result, err = library.sync(remote.fetch, false, later)
+	assert.NoError(t, err)
+	assert.False(t, result.Full)
+	assert.Equal(t, 3, result.Added)
+	assert.Equal(t, 1, remote.pages, "should stop at the first known track")
+	assert.Equal(t, later, library.LastSync)
+	assert.Equal(t, now, library.LastFullSync)
+
+	assert.Len(t, library.Tracks, 122)
+	assert.Equal(t, []string{"t3-0", "t3-1", "t1-5", "t1-0"}, trackIDs(library.Tracks[:4]))
+}
+
+func TestLibrarySyncFullDetectsRemovals(t *testing.T) {
+	now := time.Date(2018, 7, 10, 0, 0, 0, 0, time.UTC)
+	remote := &fakeLibrary{tracks: manyTracks(10, 1)}
+
+	library := &Library{Version: libraryVersion}
+	_, err := library.sync(remote.fetch, false, now)
+	assert.NoError(t, err)
+
+	// drop two tracks from the middle; an incremental sync can't see it
+	remote.tracks = append(append([]spotify.SavedTrack{}, remote.tracks[:3]...), remote.tracks[5:]...)
+	result, err := library.sync(remote.fetch, false, now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, SyncResult{}, result)
+	assert.Len(t, library.Tracks, 10)
+
+	// but a full one can, whether asked for or overdue
+	result, err = library.sync(remote.fetch, true, now.Add(2*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, SyncResult{Removed: 2, Full: true}, result)
+	assert.Len(t, library.Tracks, 8)
+
+	remote.tracks = remote.tracks[1:]
+	result, err = library.sync(remote.fetch, false, now.Add(FullSyncInterval+3*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, SyncResult{Removed: 1, Full: true}, result)
+}
+
+func TestLibrarySaveAndLoad(t *testing.T) {
+	useMemAppdir()
+	legacyLibraryFilename = "does-not-exist.data"
+
+	library, err := LoadLibrary()
+	assert.NoError(t, err)
+	assert.Empty(t, library.Tracks)
+
+	library.Tracks = manyTracks(3, 1)
+	library.LastSync = time.Date(2018, 7, 10, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, library.Save())
+
+	loaded, err := LoadLibrary()
+	assert.NoError(t, err)
+	assert.Equal(t, trackIDs(library.Tracks), trackIDs(loaded.Tracks))
+	assert.True(t, library.LastSync.Equal(loaded.LastSync))
+}
@@ -0,0 +1,180 @@
+package favs
+
+import (
+	"encoding/gob"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/brianloveswords/spotify/songkick"
+	"github.com/brianloveswords/spotify/xdg"
+	"github.com/zmb3/spotify"
+)
+
+// Pending is an artist whose songkick search results were too close to
+// call, waiting for someone to pick the right one.
+type Pending struct {
+	ArtistID   spotify.ID
+	Artist     string
+	Candidates []songkick.Candidate
+	Added      time.Time
+}
+
+var appdir = xdg.NewApp("spotify-cli")
+var reviewQueueName = "songkick-review"
+
+// UseApp keeps the library cache and artist data in app's directories
+// from now on, for switching profiles.
+func UseApp(app *xdg.App) {
+	appdir = app
+}
+
+// ReviewQueue returns the artists waiting for review, oldest first.
+func ReviewQueue() ([]Pending, error) {
+	return loadReviewQueue()
+}
+
+func loadReviewQueue() (queue []Pending, err error) {
+	f, err := appdir.DataOpen(reviewQueueName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := gob.NewDecoder(f).Decode(&queue); err != nil {
+		return nil, err
+	}
+	return migrateReviewQueue(queue), nil
+}
+
+// migrateReviewQueue fills in the spotify IDs of artists queued before
+// IDs were recorded, by looking their names up among the artists we know
+// about. Ones that don't match exactly one artist are dropped; the next
+// songkick lookup queues them again if they still need review.
+func migrateReviewQueue(queue []Pending) []Pending {
+	var byName map[string][]spotify.ID
+	seen := make(map[spotify.ID]bool)
+	var migrated []Pending
+	for _, p := range queue {
+		if p.ArtistID == "" {
+			if byName == nil {
+				byName = knownArtistIDs()
+			}
+			ids := byName[strings.ToLower(p.Artist)]
+			if len(ids) != 1 {
+				glog.Log("dropping %s from the review queue, couldn't tell which spotify artist it is", p.Artist)
+				continue
+			}
+			p.ArtistID = ids[0]
+		}
+		if seen[p.ArtistID] {
+			continue
+		}
+		seen[p.ArtistID] = true
+		migrated = append(migrated, p)
+	}
+	return migrated
+}
+
+// knownArtistIDs maps lowercased artist names to the spotify IDs of the
+// artists with that name in the artist store and the library cache.
+func knownArtistIDs() map[string][]spotify.ID {
+	byName := make(map[string][]spotify.ID)
+	add := func(name string, id spotify.ID) {
+		key := strings.ToLower(name)
+		for _, known := range byName[key] {
+			if known == id {
+				return
+			}
+		}
+		byName[key] = append(byName[key], id)
+	}
+
+	if store, err := LoadArtistStore(); err != nil {
+		glog.Debug("couldn't load artist store: %s", err)
+	} else {
+		for _, record := range store.Artists {
+			add(record.Name, record.ID)
+		}
+	}
+	if library, err := LoadLibrary(); err != nil {
+		glog.Debug("couldn't load library: %s", err)
+	} else {
+		for _, track := range library.Tracks {
+			for _, artist := range track.Artists {
+				add(artist.Name, artist.ID)
+			}
+		}
+	}
+	return byName
+}
+
+func saveReviewQueue(queue []Pending) error {
+	if len(queue) == 0 {
+		err := appdir.DataRemove(reviewQueueName)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	return saveGobAtomic(appdir.DataWriteAtomic, reviewQueueName, queue)
+}
+
+// enqueueReview adds artists to the review queue. An artist that's
+// already queued has its candidates replaced but keeps its place.
+func enqueueReview(pending []Pending) error {
+	if len(pending) == 0 {
+		return nil
+	}
+	return withLock(reviewQueueName, func() error {
+		return addToReviewQueue(pending)
+	})
+}
+
+func addToReviewQueue(pending []Pending) error {
+	queue, err := loadReviewQueue()
+	if err != nil {
+		return err
+	}
+
+	index := make(map[spotify.ID]int)
+	for i, p := range queue {
+		index[p.ArtistID] = i
+	}
+	for _, p := range pending {
+		if i, ok := index[p.ArtistID]; ok {
+			queue[i].Candidates = p.Candidates
+			continue
+		}
+		index[p.ArtistID] = len(queue)
+		queue = append(queue, p)
+	}
+	return saveReviewQueue(queue)
+}
+
+// dequeueReview drops an artist from the review queue, if it's there.
+func dequeueReview(artistID spotify.ID) error {
+	return withLock(reviewQueueName, func() error {
+		return removeFromReviewQueue(artistID)
+	})
+}
+
+func removeFromReviewQueue(artistID spotify.ID) error {
+	queue, err := loadReviewQueue()
+	if err != nil {
+		return err
+	}
+	var rest []Pending
+	for _, p := range queue {
+		if p.ArtistID != artistID {
+			rest = append(rest, p)
+		}
+	}
+	if len(rest) == len(queue) {
+		return nil
+	}
+	return saveReviewQueue(rest)
+}
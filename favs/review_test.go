@@ -0,0 +1,111 @@
+package favs
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/brianloveswords/spotify/songkick"
+	"github.com/brianloveswords/spotify/xdg"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify"
+)
+
+func useMemAppdir() {
+	appdir = &xdg.App{Home: "/", App: "test-app", AppFs: afero.NewMemMapFs()}
+	appdir.MakeDirs()
+}
+
+func TestReviewQueue(t *testing.T) {
+	useMemAppdir()
+
+	queue, err := ReviewQueue()
+	assert.NoError(t, err)
+	assert.Empty(t, queue)
+
+	gleemer := []songkick.Candidate{{ID: 1, Name: "Gleemer"}, {ID: 2, Name: "The Gleemer"}}
+	assert.NoError(t, enqueueReview([]Pending{
+		{ArtistID: "gleemer", Artist: "Gleemer", Candidates: gleemer[:1]},
+		{ArtistID: "slowmass", Artist: "Slow Mass"},
+	}))
+	assert.NoError(t, enqueueReview([]Pending{
+		{ArtistID: "gleemer", Artist: "Gleemer", Candidates: gleemer},
+		{ArtistID: "royaltrux", Artist: "Royal Trux"},
+	}))
+
+	queue, err = ReviewQueue()
+	assert.NoError(t, err)
+	if assert.Len(t, queue, 3) {
+		assert.Equal(t, "Gleemer", queue[0].Artist)
+		assert.Equal(t, gleemer, queue[0].Candidates)
+		assert.Equal(t, "Slow Mass", queue[1].Artist)
+		assert.Equal(t, "Royal Trux", queue[2].Artist)
+	}
+
+	assert.NoError(t, dequeueReview("slowmass"))
+	assert.NoError(t, dequeueReview("notqueued"))
+	queue, _ = ReviewQueue()
+	assert.Len(t, queue, 2)
+
+	assert.NoError(t, dequeueReview("gleemer"))
+	assert.NoError(t, dequeueReview("royaltrux"))
+	queue, _ = ReviewQueue()
+	assert.Empty(t, queue)
+}
+
+func TestEnqueueReviewConcurrently(t *testing.T) {
+	useMemAppdir()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := spotify.ID(fmt.Sprintf("artist%d", i))
+			assert.NoError(t, enqueueReview([]Pending{{ArtistID: id, Artist: string(id)}}))
+		}(i)
+	}
+	wg.Wait()
+
+	// none of them saved over another's
+	queue, err := ReviewQueue()
+	assert.NoError(t, err)
+	assert.Len(t, queue, 20)
+}
+
+func TestReviewQueueMigratesEntriesWithoutIDs(t *testing.T) {
+	useMemAppdir()
+
+	store := newArtistStore()
+	store.Set("slowmass", "Slow Mass", 0, SourceSearch)
+	assert.NoError(t, store.Save())
+	library := &Library{Version: libraryVersion, Tracks: []spotify.SavedTrack{
+		savedTrackBy("gleemer", "Gleemer"),
+		savedTrackBy("twin1", "Twin"),
+		savedTrackBy("twin2", "twin"),
+	}}
+	assert.NoError(t, library.Save())
+
+	// queued before Pending had an ArtistID
+	assert.NoError(t, saveReviewQueue([]Pending{
+		{Artist: "Gleemer"},
+		{Artist: "slow mass"},
+		{Artist: "Twin"},
+		{Artist: "Nobody"},
+		{ArtistID: "gleemer", Artist: "Gleemer"},
+	}))
+
+	queue, err := ReviewQueue()
+	assert.NoError(t, err)
+	assert.Equal(t, []Pending{
+		{ArtistID: "gleemer", Artist: "Gleemer"},
+		{ArtistID: "slowmass", Artist: "slow mass"},
+	}, queue)
+}
+
+func savedTrackBy(artistID spotify.ID, artist string) spotify.SavedTrack {
+	var track spotify.SavedTrack
+	track.Artists = []spotify.SimpleArtist{{ID: artistID, Name: artist}}
+	return track
+}
@@ -0,0 +1,336 @@
+package favs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianloveswords/spotify/songkick"
+	"github.com/fatih/color"
+	"github.com/zmb3/spotify"
+)
+
+// LookupSongkickIDs fills in the SongkickID of each artist, using the
+// artist store where possible and searching songkick otherwise. Search
+// results are accepted automatically when the best match is
+// unambiguous. For the rest, if interactive is true the candidates are
+// listed and the choice is read from stdin; otherwise they're added to
+// the review queue to be sorted out later with ReviewSongkickIDs.
+func LookupSongkickIDs(sk songkick.Client, artists []Artist, interactive bool) error {
+	store, err := LoadArtistStore()
+	if err != nil {
+		return err
+	}
+
+	var notfound []*Artist
+	var manual []Pending
+	var found []ArtistRecord
+
+	for i := range artists {
+		artist := &artists[i]
+		if record, ok := store.Get(artist.ID, artist.Name); ok {
+			artist.SongkickID = record.SongkickID
+			if record.Source == SourceLegacy {
+				found = append(found, record)
+			}
+		}
+
+		if artist.SongkickID == songkick.Unknown {
+			notfound = append(notfound, artist)
+		}
+	}
+
+	glog.Log("looking up songkick IDs for %d artists...", len(notfound))
+
+	for _, artist := range notfound {
+		// try to look up automatically
+		candidates, err := sk.SearchArtists(artist.Name)
+		if err != nil {
+			glog.Log("couldn't search songkick for %s: %s", artist.Name, err)
+			continue
+		}
+		if len(candidates) == 0 {
+			glog.Verbose("no songkick results for %s", artist.Name)
+			artist.SongkickID = songkick.NotFound
+			found = append(found, ArtistRecord{ID: artist.ID, Name: artist.Name, SongkickID: songkick.NotFound, Source: SourceSearch})
+			continue
+		}
+		best, ok := songkick.Best(candidates)
+		if !ok {
+			manual = append(manual, Pending{
+				ArtistID:   artist.ID,
+				Artist:     artist.Name,
+				Candidates: candidates,
+				Added:      time.Now(),
+			})
+			glog.Log("results unclear for %s, skipping...", artist.Name)
+			continue
+		}
+		glog.Verbose("songkick ID for %s: %d (%s, score %.2f)", artist.Name, best.ID, best.Name, best.Score)
+		artist.SongkickID = best.ID
+		found = append(found, ArtistRecord{ID: artist.ID, Name: artist.Name, SongkickID: best.ID, Source: SourceSearch})
+	}
+
+	if err := saveArtistRecords(found); err != nil {
+		return err
+	}
+
+	if len(manual) == 0 {
+		return nil
+	}
+
+	if !interactive {
+		if err := enqueueReview(manual); err != nil {
+			return fmt.Errorf("couldn't save review queue: %s", err)
+		}
+		glog.Log("queued %d artists for review, see %s", len(manual), color.CyanString("songkick review"))
+		return nil
+	}
+
+	glog.Log("manual identification needed for %d artists:", len(manual))
+
+	var skipped []Pending
+	reader := bufio.NewReader(os.Stdin)
+	for _, p := range manual {
+		id, ok := promptForSongkickID(reader, p)
+		if !ok {
+			skipped = append(skipped, p)
+			continue
+		}
+		record := ArtistRecord{ID: p.ArtistID, Name: p.Artist, SongkickID: id, Source: SourceManual}
+		if err := saveArtistRecords([]ArtistRecord{record}); err != nil {
+			return err
+		}
+		for i := range artists {
+			if artists[i].ID == p.ArtistID {
+				artists[i].SongkickID = id
+			}
+		}
+	}
+
+	return enqueueReview(skipped)
+}
+
+// saveArtistRecords adds records to the artist store, holding its lock
+// only while it loads, changes and saves it, so searching songkick and
+// waiting for answers doesn't keep other commands out. A search result
+// doesn't replace an ID someone saved in the meantime, and legacy
+// records are migrated the way Get does it.
+func saveArtistRecords(records []ArtistRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return withLock(artistStoreName, func() error {
+		store, err := LoadArtistStore()
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			switch r.Source {
+			case SourceLegacy:
+				store.Get(r.ID, r.Name)
+			case SourceSearch:
+				if _, ok := store.Artists[r.ID]; !ok {
+					store.Set(r.ID, r.Name, r.SongkickID, r.Source)
+				}
+			default:
+				store.Set(r.ID, r.Name, r.SongkickID, r.Source)
+			}
+		}
+		return store.Save()
+	})
+}
+
+// ReviewSongkickIDs walks through the review queue asking for the right
+// songkick ID for each artist. Anything skipped stays in the queue.
+func ReviewSongkickIDs() error {
+	return withLock(artistStoreName, func() error {
+		return withLock(reviewQueueName, reviewSongkickIDs)
+	})
+}
+
+func reviewSongkickIDs() error {
+	queue, err := loadReviewQueue()
+	if err != nil {
+		return err
+	}
+	if len(queue) == 0 {
+		glog.Log("nothing to review")
+		return nil
+	}
+
+	glog.Log("%d artists to review", len(queue))
+
+	store, err := LoadArtistStore()
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(os.Stdin)
+
+	var skipped []Pending
+	for i, p := range queue {
+		id, ok := promptForSongkickID(reader, p)
+		if ok {
+			store.Set(p.ArtistID, p.Artist, id, SourceManual)
+			if err := store.Save(); err != nil {
+				return err
+			}
+		} else {
+			skipped = append(skipped, p)
+		}
+
+		// save as we go so quitting halfway doesn't lose answers
+		rest := append(append([]Pending{}, skipped...), queue[i+1:]...)
+		if err := saveReviewQueue(rest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetSongkickID saves id as the songkick ID for artist, replacing
+// whatever was there before and dropping it from the review queue.
+// artist can be a name we've seen before or a spotify artist ID.
+func SetSongkickID(artist string, id int) error {
+	return withLock(artistStoreName, func() error {
+		return setSongkickID(artist, id)
+	})
+}
+
+func setSongkickID(artist string, id int) error {
+	store, err := LoadArtistStore()
+	if err != nil {
+		return err
+	}
+	artistID, name, err := resolveArtist(store, artist)
+	if err != nil {
+		return err
+	}
+	store.Set(artistID, name, id, SourceManual)
+	if err := store.Save(); err != nil {
+		return err
+	}
+	return dequeueReview(artistID)
+}
+
+// UnsetSongkickID forgets the songkick ID for artist so it gets looked
+// up again next time. artist can be a name or a spotify artist ID.
+func UnsetSongkickID(artist string) error {
+	return withLock(artistStoreName, func() error {
+		return unsetSongkickID(artist)
+	})
+}
+
+func unsetSongkickID(artist string) error {
+	store, err := LoadArtistStore()
+	if err != nil {
+		return err
+	}
+	if _, ok := store.Legacy[artist]; ok {
+		delete(store.Legacy, artist)
+		return store.Save()
+	}
+	artistID, _, err := resolveArtist(store, artist)
+	if err != nil {
+		return err
+	}
+	if !store.Delete(artistID) {
+		return fmt.Errorf("no songkick ID saved for %s", artist)
+	}
+	return store.Save()
+}
+
+// resolveArtist works out which spotify artist someone means when they
+// name one on the command line, using the artist store and the review
+// queue since those are the artists we know about.
+func resolveArtist(store *ArtistStore, artist string) (spotify.ID, string, error) {
+	if record, ok := store.Artists[spotify.ID(artist)]; ok {
+		return record.ID, record.Name, nil
+	}
+
+	found := store.FindByName(artist)
+	if len(found) == 1 {
+		return found[0].ID, found[0].Name, nil
+	}
+	if len(found) > 1 {
+		var ids []string
+		for _, record := range found {
+			ids = append(ids, string(record.ID))
+		}
+		return "", "", fmt.Errorf("%s is ambiguous, use one of the spotify IDs: %s",
+			artist, strings.Join(ids, ", "))
+	}
+
+	queue, err := loadReviewQueue()
+	if err != nil {
+		return "", "", err
+	}
+	for _, p := range queue {
+		if strings.EqualFold(p.Artist, artist) || string(p.ArtistID) == artist {
+			return p.ArtistID, p.Artist, nil
+		}
+	}
+
+	if reSpotifyID.MatchString(artist) {
+		return spotify.ID(artist), "", nil
+	}
+	return "", "", fmt.Errorf("don't know the spotify ID for %s, pass it instead of the name", artist)
+}
+
+// spotify IDs are 22 characters of base62
+var reSpotifyID = regexp.MustCompile(`^[0-9A-Za-z]{22}$`)
+
+// promptForSongkickID lists the candidates for an ambiguous artist and
+// reads a choice from stdin. ok is false if the person wants to skip the
+// artist for now.
+func promptForSongkickID(reader *bufio.Reader, p Pending) (id int, ok bool) {
+	glog.Log("\n%s", color.YellowString(p.Artist))
+	for i, c := range p.Candidates {
+		glog.Log("%d) %s", i+1, describeCandidate(c))
+	}
+	glog.Log("search: %s", songkick.ArtistSearchURL(p.Artist))
+
+	// read from stdin until we get a valid input
+	for {
+		glog.Prompt("pick 1-%d, enter a songkick ID, s to skip, or leave empty for none", len(p.Candidates))
+		text, err := reader.ReadString('\n')
+		text = strings.Trim(text, "\n ")
+
+		if text == "s" || (err != nil && text == "") {
+			return 0, false
+		}
+
+		if text == "" {
+			glog.Log("marking %s as not found\n", p.Artist)
+			return songkick.NotFound, true
+		}
+
+		id, err := strconv.Atoi(text)
+		if err != nil {
+			glog.Log("invalid ID %s, must be an int\n", text)
+			continue
+		}
+
+		// small numbers are picks from the list, anything else is an
+		// ID copied from the songkick site
+		if id >= 1 && id <= len(p.Candidates) {
+			id = p.Candidates[id-1].ID
+		}
+		return id, true
+	}
+}
+
+func describeCandidate(c songkick.Candidate) string {
+	desc := color.BlueString(c.Name)
+	if c.Snippet != "" {
+		desc += " (" + c.Snippet + ")"
+	}
+	if c.OnTour {
+		desc += color.GreenString(" on tour")
+	}
+	return fmt.Sprintf("%s %s", desc, songkick.ArtistURL(c.ID))
+}
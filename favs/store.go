@@ -0,0 +1,168 @@
+package favs
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+// ArtistSource records how an artist's songkick ID was decided.
+type ArtistSource string
+
+const (
+	// SourceSearch is a songkick search result that was accepted
+	// automatically
+	SourceSearch ArtistSource = "search"
+	// SourceManual is an ID picked or entered by a person
+	SourceManual ArtistSource = "manual"
+	// SourceLegacy is an ID carried over from the old name-keyed
+	// artist-songkick.data file
+	SourceLegacy ArtistSource = "legacy"
+)
+
+// ArtistRecord is everything we know about an artist outside of
+// spotify.
+type ArtistRecord struct {
+	ID         spotify.ID
+	Name       string
+	SongkickID int
+	Source     ArtistSource
+	Updated    time.Time
+}
+
+// ArtistStore maps spotify artist IDs to what we know about them. It's
+// loaded and saved as a whole; callers should Save once they're done
+// making changes rather than after each one.
+type ArtistStore struct {
+	Version int
+	Artists map[spotify.ID]ArtistRecord
+	// Legacy holds songkick IDs from the old name-keyed file that
+	// haven't been matched up with a spotify ID yet. They're promoted
+	// to real records the first time Get sees the name.
+	Legacy map[string]int
+}
+
+// artistStoreVersion is bumped whenever the layout of ArtistStore
+// changes in a way that needs migrating.
+const artistStoreVersion = 1
+
+var artistStoreName = "artists"
+
+// legacySongkickFilename is where songkick IDs used to be kept, as a gob
+// map[string]int keyed by artist name in the working directory.
+var legacySongkickFilename = "artist-songkick.data"
+
+func newArtistStore() *ArtistStore {
+	return &ArtistStore{
+		Version: artistStoreVersion,
+		Artists: make(map[spotify.ID]ArtistRecord),
+		Legacy:  make(map[string]int),
+	}
+}
+
+// LoadArtistStore reads the artist store from the data directory. If
+// there isn't one yet, it starts a new store and migrates any songkick
+// IDs from the old artist-songkick.data file.
+func LoadArtistStore() (*ArtistStore, error) {
+	f, err := appdir.DataOpen(artistStoreName)
+	if os.IsNotExist(err) {
+		store := newArtistStore()
+		if err := store.migrateLegacy(legacySongkickFilename); err != nil {
+			return nil, fmt.Errorf("couldn't migrate %s: %s", legacySongkickFilename, err)
+		}
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	store := newArtistStore()
+	if err := gob.NewDecoder(f).Decode(store); err != nil {
+		return nil, fmt.Errorf("couldn't decode artist store: %s", err)
+	}
+	if store.Version > artistStoreVersion {
+		return nil, fmt.Errorf("artist store is version %d, this build only understands up to %d",
+			store.Version, artistStoreVersion)
+	}
+	store.Version = artistStoreVersion
+	return store, nil
+}
+
+func (s *ArtistStore) migrateLegacy(filename string) error {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var legacy map[string]int
+	if err := gob.NewDecoder(f).Decode(&legacy); err != nil {
+		return err
+	}
+	for name, id := range legacy {
+		s.Legacy[name] = id
+	}
+	glog.Verbose("migrating %d songkick IDs from %s", len(legacy), filename)
+	return nil
+}
+
+// Save writes the store out atomically, so a crash halfway through
+// can't leave a torn file behind.
+func (s *ArtistStore) Save() error {
+	return saveGobAtomic(appdir.DataWriteAtomic, artistStoreName, s)
+}
+
+// Get returns the record for the artist with the given spotify ID. The
+// name is used to pick up any legacy songkick ID saved under it.
+func (s *ArtistStore) Get(id spotify.ID, name string) (ArtistRecord, bool) {
+	if record, ok := s.Artists[id]; ok {
+		return record, true
+	}
+	if skid, ok := s.Legacy[name]; ok {
+		delete(s.Legacy, name)
+		return s.Set(id, name, skid, SourceLegacy), true
+	}
+	return ArtistRecord{}, false
+}
+
+// Set saves the songkick ID for an artist and returns the new record.
+func (s *ArtistStore) Set(id spotify.ID, name string, songkickID int, source ArtistSource) ArtistRecord {
+	record := ArtistRecord{
+		ID:         id,
+		Name:       name,
+		SongkickID: songkickID,
+		Source:     source,
+		Updated:    time.Now(),
+	}
+	s.Artists[id] = record
+	return record
+}
+
+// Delete forgets everything about the artist with the given spotify ID.
+// It reports whether there was anything to forget.
+func (s *ArtistStore) Delete(id spotify.ID) bool {
+	if _, ok := s.Artists[id]; !ok {
+		return false
+	}
+	delete(s.Artists, id)
+	return true
+}
+
+// FindByName returns the records whose name matches, ignoring case.
+// There can be more than one, since artist names aren't unique.
+func (s *ArtistStore) FindByName(name string) (found []ArtistRecord) {
+	for _, record := range s.Artists {
+		if strings.EqualFold(record.Name, name) {
+			found = append(found, record)
+		}
+	}
+	return found
+}
@@ -0,0 +1,133 @@
+package favs
+
+import (
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/brianloveswords/spotify/songkick"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArtistStoreSaveAndLoad(t *testing.T) {
+	useMemAppdir()
+	legacySongkickFilename = "does-not-exist.data"
+
+	store, err := LoadArtistStore()
+	assert.NoError(t, err)
+	assert.Empty(t, store.Artists)
+
+	store.Set("gleemerid", "Gleemer", 7180534, SourceSearch)
+	store.Set("nobodyid", "Nobody", songkick.NotFound, SourceManual)
+	assert.NoError(t, store.Save())
+
+	store, err = LoadArtistStore()
+	assert.NoError(t, err)
+	assert.Equal(t, artistStoreVersion, store.Version)
+
+	record, ok := store.Get("gleemerid", "Gleemer")
+	assert.True(t, ok)
+	assert.Equal(t, 7180534, record.SongkickID)
+	assert.Equal(t, SourceSearch, record.Source)
+	assert.False(t, record.Updated.IsZero())
+
+	assert.Len(t, store.FindByName("gleemer"), 1)
+	assert.True(t, store.Delete("gleemerid"))
+	assert.False(t, store.Delete("gleemerid"))
+
+	// saving again replaces the old file
+	assert.NoError(t, store.Save())
+	store, err = LoadArtistStore()
+	assert.NoError(t, err)
+	assert.Len(t, store.Artists, 1)
+
+	// the temporary file shouldn't be left lying around
+	_, err = appdir.DataOpen(artistStoreName + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestArtistStoreRejectsNewerVersion(t *testing.T) {
+	useMemAppdir()
+
+	store := newArtistStore()
+	store.Version = artistStoreVersion + 1
+	assert.NoError(t, store.Save())
+
+	_, err := LoadArtistStore()
+	assert.Error(t, err)
+}
+
+func TestArtistStoreMigratesLegacyFile(t *testing.T) {
+	useMemAppdir()
+
+	dir, err := ioutil.TempDir("", "favs")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	legacySongkickFilename = filepath.Join(dir, "artist-songkick.data")
+	f, err := os.Create(legacySongkickFilename)
+	assert.NoError(t, err)
+	assert.NoError(t, gob.NewEncoder(f).Encode(map[string]int{
+		"Gleemer":   7180534,
+		"Slow Mass": songkick.NotFound,
+	}))
+	f.Close()
+
+	store, err := LoadArtistStore()
+	assert.NoError(t, err)
+	assert.Len(t, store.Legacy, 2)
+
+	// legacy IDs are keyed by name until we see the artist's spotify ID
+	record, ok := store.Get("gleemerid", "Gleemer")
+	assert.True(t, ok)
+	assert.Equal(t, 7180534, record.SongkickID)
+	assert.Equal(t, SourceLegacy, record.Source)
+	assert.Len(t, store.Legacy, 1)
+	assert.NoError(t, store.Save())
+
+	// once there's a store, the legacy file isn't read again
+	store, err = LoadArtistStore()
+	assert.NoError(t, err)
+	assert.Len(t, store.Artists, 1)
+	assert.Len(t, store.Legacy, 1)
+}
+
+// searchingClient answers songkick searches with one exact match,
+// running during first, like another command would.
+type searchingClient struct {
+	songkick.Client
+	during func()
+}
+
+func (c *searchingClient) SearchArtists(name string) ([]songkick.Candidate, error) {
+	if c.during != nil {
+		c.during()
+		c.during = nil
+	}
+	return []songkick.Candidate{{ID: 7, Name: name, Score: songkick.ScoreExact}}, nil
+}
+
+func TestLookupSongkickIDsDoesNotHoldStoreWhileSearching(t *testing.T) {
+	useMemAppdir()
+	legacySongkickFilename = "does-not-exist.data"
+
+	store, err := LoadArtistStore()
+	assert.NoError(t, err)
+	store.Set("slowmass", "Slow Mass", songkick.NotFound, SourceSearch)
+	assert.NoError(t, store.Save())
+
+	// this would wait forever if the lookup held the store's lock
+	sk := &searchingClient{during: func() {
+		assert.NoError(t, SetSongkickID("slowmass", 42))
+	}}
+	artists := []Artist{{ID: "gleemer", Name: "Gleemer"}}
+	assert.NoError(t, LookupSongkickIDs(sk, artists, false))
+	assert.Equal(t, 7, artists[0].SongkickID)
+
+	store, err = LoadArtistStore()
+	assert.NoError(t, err)
+	assert.Equal(t, 7, store.Artists["gleemer"].SongkickID)
+	assert.Equal(t, 42, store.Artists["slowmass"].SongkickID)
+}
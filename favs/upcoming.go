@@ -0,0 +1,86 @@
+package favs
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/brianloveswords/spotify/songkick"
+	"github.com/fatih/color"
+)
+
+// Show is an upcoming songkick event for an artist in the library.
+type Show struct {
+	Artist Artist
+	songkick.Event
+}
+
+// ShowFilter narrows down which events make it into the report. A zero
+// value matches everything.
+type ShowFilter struct {
+	// Metro is matched case-insensitively against the event location,
+	// e.g. "Brooklyn" or "London, UK"
+	Metro string
+	From  time.Time
+	Until time.Time
+}
+
+// Match reports whether the event is in the metro area and inside the
+// date window.
+func (f ShowFilter) Match(event songkick.Event) bool {
+	if f.Metro != "" && !strings.Contains(strings.ToLower(event.Location), strings.ToLower(f.Metro)) {
+		return false
+	}
+	if !f.From.IsZero() && event.Date.Before(f.From) {
+		return false
+	}
+	if !f.Until.IsZero() && event.Date.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// TopArtists returns the n artists with the most saved tracks in the
+// library, syncing the library first. If n is zero or negative, every
+// artist is returned.
+func TopArtists(client LibraryClient, n int) ([]Artist, error) {
+	tracks, err := getAllTracks(client)
+	if err != nil {
+		return nil, err
+	}
+	artists := processTracklist(tracks)
+	if n > 0 && n < len(artists) {
+		artists = artists[:n]
+	}
+	return artists, nil
+}
+
+// UpcomingShows fetches the songkick calendar for each artist with a
+// known songkick ID and returns every event that matches the filter,
+// sorted by date.
+func UpcomingShows(sk songkick.Client, artists []Artist, filter ShowFilter) (shows []Show) {
+	defer glog.Enter("favs.UpcomingShows")()
+	for _, artist := range artists {
+		if artist.SongkickID == songkick.Unknown || artist.SongkickID == songkick.NotFound {
+			continue
+		}
+
+		events, err := sk.ArtistEvents(artist.SongkickID)
+		if err != nil {
+			glog.Log("couldn't get events for %s: %s", color.RedString(artist.Name), err)
+			continue
+		}
+		glog.Debug("found %d events for %s", len(events), artist.Name)
+
+		for _, event := range events {
+			if filter.Match(event) {
+				shows = append(shows, Show{Artist: artist, Event: event})
+			}
+		}
+	}
+
+	sort.SliceStable(shows, func(i, j int) bool {
+		return shows[i].Date.Before(shows[j].Date)
+	})
+	return shows
+}
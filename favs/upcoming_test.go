@@ -0,0 +1,26 @@
+package favs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brianloveswords/spotify/songkick"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShowFilterMatch(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2018, 10, d, 0, 0, 0, 0, time.UTC)
+	}
+	filter := ShowFilter{
+		Metro: "brooklyn",
+		From:  day(10),
+		Until: day(20),
+	}
+
+	assert.True(t, filter.Match(songkick.Event{Location: "Alphaville, Brooklyn, NY, US", Date: day(10)}))
+	assert.True(t, filter.Match(songkick.Event{Location: "Alphaville, Brooklyn, NY, US", Date: day(20)}))
+	assert.False(t, filter.Match(songkick.Event{Location: "The Echo, Los Angeles, CA, US", Date: day(15)}))
+	assert.False(t, filter.Match(songkick.Event{Location: "Alphaville, Brooklyn, NY, US", Date: day(21)}))
+	assert.True(t, ShowFilter{}.Match(songkick.Event{}))
+}
@@ -0,0 +1,81 @@
+// Package fetch is the shared plumbing for talking to the spotify API
+// in bulk: a bounded worker pool for fetching many pages at once, and an
+// http.RoundTripper that backs off when spotify asks it to.
+package fetch
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultWorkers is how many requests we make at once by default. It's
+// deliberately small; spotify rate limits per app, not per request.
+var DefaultWorkers = 4
+
+// Map calls fn once for each index in [0, n), running at most workers
+// calls at a time, and waits for all of them to finish. Callers keep
+// results in order by having fn store them at index i of a slice they
+// allocated up front. If any call fails, Map returns the error from the
+// lowest failing index, the same error a sequential loop would have hit
+// first; calls that haven't started yet are skipped. The same happens
+// when ctx is done, with ctx's error if no call failed.
+//
+// fn gets ctx to log through, since the calls run concurrently: see
+// logger.EnterContext.
+func Map(ctx context.Context, n, workers int, fn func(ctx context.Context, i int) error) error {
+	if workers < 1 {
+		workers = DefaultWorkers
+	}
+	if workers > n {
+		workers = n
+	}
+
+	var (
+		mu       sync.Mutex
+		failed   = false
+		firstErr error
+		firstIdx = n
+		wg       sync.WaitGroup
+		indexes  = make(chan int)
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				err := fn(ctx, i)
+				if err == nil {
+					continue
+				}
+				mu.Lock()
+				failed = true
+				if i < firstIdx {
+					firstIdx, firstErr = i, err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var stopped error
+	for i := 0; i < n; i++ {
+		mu.Lock()
+		stop := failed
+		mu.Unlock()
+		if stop {
+			break
+		}
+		if stopped = ctx.Err(); stopped != nil {
+			break
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return stopped
+}
@@ -0,0 +1,78 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapPreservesOrder(t *testing.T) {
+	results := make([]int, 100)
+	err := Map(context.Background(), len(results), 8, func(ctx context.Context, i int) error {
+		// finish out of order on purpose
+		time.Sleep(time.Duration(100-i) * time.Microsecond)
+		results[i] = i * i
+		return nil
+	})
+	assert.NoError(t, err)
+	for i, v := range results {
+		assert.Equal(t, i*i, v)
+	}
+}
+
+func TestMapBoundsConcurrency(t *testing.T) {
+	var running, most int32
+	err := Map(context.Background(), 50, 3, func(ctx context.Context, i int) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, most <= 3, "ran %d at once", most)
+}
+
+func TestMapReturnsFirstError(t *testing.T) {
+	err := Map(context.Background(), 10, 4, func(ctx context.Context, i int) error {
+		if i == 7 {
+			return errors.New("seven")
+		}
+		if i == 2 {
+			time.Sleep(5 * time.Millisecond)
+			return errors.New("two")
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "two")
+
+	assert.NoError(t, Map(context.Background(), 0, 4, func(ctx context.Context, i int) error {
+		t.Fatal("shouldn't be called")
+		return nil
+	}))
+}
+
+type key struct{}
+
+func TestMapPassesContextAndStopsWhenDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "value"))
+	var calls int32
+	err := Map(ctx, 100, 2, func(ctx context.Context, i int) error {
+		assert.Equal(t, "value", ctx.Value(key{}))
+		if atomic.AddInt32(&calls, 1) == 5 {
+			cancel()
+		}
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, calls < 100, "made all %d calls", calls)
+}
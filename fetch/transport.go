@@ -0,0 +1,157 @@
+package fetch
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Transport retries requests that spotify turned away with 429 Too Many
+// Requests, waiting as long as the Retry-After header says, and
+// idempotent requests that failed with a transient 5xx error, backing off
+// exponentially. Others, like a POST adding tracks to a playlist, might
+// have been applied before the error, so retrying could do it twice.
+type Transport struct {
+	// Base does the actual requests. If nil, http.DefaultTransport is
+	// used.
+	Base http.RoundTripper
+	// MaxRetries is how many times a request is retried before giving
+	// up and returning the last response.
+	MaxRetries int
+	// MinBackoff is the first wait after a 5xx, doubling each retry.
+	// It's also used for a 429 without a usable Retry-After.
+	MinBackoff time.Duration
+	// MaxBackoff caps the wait after a 5xx. A 429 whose Retry-After is
+	// longer than this is returned rather than waited out.
+	MaxBackoff time.Duration
+
+	// sleep waits for d or until the request is cancelled; tests swap
+	// it out so they don't actually wait.
+	sleep func(req *http.Request, d time.Duration) error
+}
+
+// NewTransport returns a Transport wrapping base with sensible
+// defaults.
+func NewTransport(base http.RoundTripper) *Transport {
+	return &Transport{
+		Base:       base,
+		MaxRetries: 5,
+		MinBackoff: 500 * time.Millisecond,
+		MaxBackoff: 30 * time.Second,
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	sleep := t.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+
+	backoff := t.MinBackoff
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.Body != nil {
+			// the previous attempt consumed the body, so get a fresh one
+			if req.GetBody == nil {
+				return nil, errBodyNotReplayable
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := base.RoundTrip(req)
+		if err != nil || attempt >= t.MaxRetries {
+			return resp, err
+		}
+
+		var wait time.Duration
+		switch {
+		case resp.StatusCode == http.StatusTooManyRequests:
+			wait = retryAfter(resp.Header.Get("Retry-After"), backoff)
+			if t.MaxBackoff > 0 && wait > t.MaxBackoff {
+				// retrying any sooner would only be turned away again
+				return resp, nil
+			}
+		case isTransient(resp.StatusCode) && isIdempotent(req.Method):
+			wait = backoff
+			if t.MaxBackoff > 0 && wait > t.MaxBackoff {
+				wait = t.MaxBackoff
+			}
+			backoff *= 2
+		default:
+			return resp, nil
+		}
+
+		// drain the body so the connection can be reused
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+
+		if err := sleep(req, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type fetchError string
+
+func (e fetchError) Error() string { return string(e) }
+
+const errBodyNotReplayable = fetchError("fetch: can't retry request, body can't be replayed")
+
+func isTransient(status int) bool {
+	switch status {
+	case http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// isIdempotent reports whether doing a request with method twice has
+// the same effect as doing it once.
+func isIdempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date.
+func retryAfter(header string, fallback time.Duration) time.Duration {
+	if header == "" {
+		return fallback
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if when, err := http.ParseTime(header); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return fallback
+}
+
+func sleepContext(req *http.Request, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
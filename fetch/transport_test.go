@@ -0,0 +1,147 @@
+package fetch
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flaky answers with each status in turn, then 200 forever.
+func flaky(t *testing.T, headers http.Header, statuses ...int) (*httptest.Server, *int) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		calls++
+		if calls <= len(statuses) {
+			for k, v := range headers {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(statuses[calls-1])
+			return
+		}
+		w.Write(append([]byte("ok:"), body...))
+	}))
+	return server, &calls
+}
+
+func testTransport(waits *[]time.Duration) *Transport {
+	tr := NewTransport(nil)
+	tr.sleep = func(req *http.Request, d time.Duration) error {
+		*waits = append(*waits, d)
+		return nil
+	}
+	return tr
+}
+
+func TestTransportHonoursRetryAfter(t *testing.T) {
+	server, calls := flaky(t, http.Header{"Retry-After": {"3"}}, 429, 429)
+	defer server.Close()
+
+	var waits []time.Duration
+	client := &http.Client{Transport: testTransport(&waits)}
+
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 3, *calls)
+	assert.Equal(t, []time.Duration{3 * time.Second, 3 * time.Second}, waits)
+}
+
+func TestTransportBacksOffOn5xx(t *testing.T) {
+	server, calls := flaky(t, nil, 502, 503, 500)
+	defer server.Close()
+
+	var waits []time.Duration
+	client := &http.Client{Transport: testTransport(&waits)}
+
+	req, err := http.NewRequest("PUT", server.URL, strings.NewReader("body"))
+	assert.NoError(t, err)
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	b, _ := ioutil.ReadAll(resp.Body)
+	assert.Equal(t, "ok:body", string(b), "body should be replayed on retry")
+	assert.Equal(t, 4, *calls)
+	assert.Equal(t, []time.Duration{
+		500 * time.Millisecond,
+		time.Second,
+		2 * time.Second,
+	}, waits)
+}
+
+func TestTransportDoesNotRetryPostOn5xx(t *testing.T) {
+	server, calls := flaky(t, http.Header{"Retry-After": {"1"}}, 502, 429)
+	defer server.Close()
+
+	var waits []time.Duration
+	client := &http.Client{Transport: testTransport(&waits)}
+
+	// spotify may have made the playlist before the 502
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("body"))
+	assert.NoError(t, err)
+	assert.Equal(t, 502, resp.StatusCode)
+	assert.Equal(t, 1, *calls)
+
+	// but a 429 means it didn't do anything
+	resp, err = client.Post(server.URL, "text/plain", strings.NewReader("body"))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, 3, *calls)
+	assert.Equal(t, []time.Duration{time.Second}, waits)
+}
+
+func TestTransportReturnsLongRetryAfter(t *testing.T) {
+	server, calls := flaky(t, http.Header{"Retry-After": {"3600"}}, 429)
+	defer server.Close()
+
+	var waits []time.Duration
+	client := &http.Client{Transport: testTransport(&waits)}
+
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Equal(t, "3600", resp.Header.Get("Retry-After"))
+	assert.Equal(t, 1, *calls)
+	assert.Empty(t, waits)
+}
+
+func TestTransportGivesUp(t *testing.T) {
+	server, calls := flaky(t, http.Header{"Retry-After": {"3"}}, 429, 429, 429, 429, 429, 429, 429)
+	defer server.Close()
+
+	var waits []time.Duration
+	tr := testTransport(&waits)
+	tr.MaxRetries = 2
+	client := &http.Client{Transport: tr}
+
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, 429, resp.StatusCode)
+	assert.Equal(t, 3, *calls)
+	assert.Equal(t, []time.Duration{3 * time.Second, 3 * time.Second}, waits)
+}
+
+func TestTransportLeavesOtherErrorsAlone(t *testing.T) {
+	server, calls := flaky(t, nil, 404)
+	defer server.Close()
+
+	var waits []time.Duration
+	client := &http.Client{Transport: testTransport(&waits)}
+
+	resp, err := client.Get(server.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, 404, resp.StatusCode)
+	assert.Equal(t, 1, *calls)
+	assert.Empty(t, waits)
+}
+
+func TestRetryAfter(t *testing.T) {
+	assert.Equal(t, 5*time.Second, retryAfter("5", time.Second))
+	assert.Equal(t, time.Second, retryAfter("", time.Second))
+	assert.Equal(t, time.Second, retryAfter("soon", time.Second))
+	assert.Equal(t, time.Duration(0), retryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), time.Second))
+}
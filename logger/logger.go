@@ -1,11 +1,16 @@
 package logger
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
 type Logger struct {
@@ -14,6 +19,14 @@ type Logger struct {
 	Stdout      io.Writer
 	DebugPrefix string
 	Level       Level
+	Format      Format
+	// LogFile, if set, gets every line logged at Level. Verbose, debug
+	// and extreme lines go only there instead of to Stderr.
+	LogFile io.Writer
+
+	// path is the call path from a context, see Context
+	path   []string
+	fields []interface{}
 }
 
 type Level int
@@ -26,8 +39,70 @@ const (
 	LevelExtreme
 )
 
+var levelNames = map[Level]string{
+	LevelSilent:  "silent",
+	LevelNormal:  "normal",
+	LevelVerbose: "verbose",
+	LevelDebug:   "debug",
+	LevelExtreme: "extreme",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// Format is how log lines are written.
+type Format int
+
+const (
+	// FormatText is plain lines for people.
+	FormatText Format = iota
+	// FormatJSON is one JSON object per line with the time, level, call
+	// path, message and any fields.
+	FormatJSON
+)
+
+// ParseFormat parses "text" or "json".
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "", "text":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	}
+	return FormatText, fmt.Errorf("unknown log format %q, expected text or json", s)
+}
+
+// ParseLevel parses a level name, optionally followed by a colon and a
+// file to log to, like "debug:/tmp/spotify.log".
+func ParseLevel(s string) (level Level, file string, err error) {
+	if i := strings.Index(s, ":"); i >= 0 {
+		s, file = s[:i], s[i+1:]
+	}
+	if s == "" {
+		return LevelNormal, file, nil
+	}
+	for level, name := range levelNames {
+		if name == s {
+			return level, file, nil
+		}
+	}
+	return LevelNormal, file, fmt.Errorf("unknown log level %q", s)
+}
+
 var DefaultDebugPrefix = "[debug] "
 
+// now is when a line is logged, replaced in tests.
+var now = time.Now
+
+// outMu keeps lines from different goroutines, and from copies of a
+// logger writing to the same place, from interleaving. It also guards
+// Stack.
+var outMu sync.Mutex
+
 func New() Logger {
 	return Logger{
 		Stderr:      os.Stderr,
@@ -44,6 +119,17 @@ func (l *Logger) Write(p []byte) (n int, err error) {
 	return l.Stderr.Write(p)
 }
 
+// OpenLogFile sends the log to the file name as well, see LogFile. The
+// file is appended to.
+func (l *Logger) OpenLogFile(name string) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("couldn't open log file: %s", err)
+	}
+	l.LogFile = f
+	return nil
+}
+
 func (l *Logger) Fatal(format string, v ...interface{}) {
 	l.Log(format, v...)
 	os.Exit(1)
@@ -53,22 +139,20 @@ func (l *Logger) Extreme(format string, v ...interface{}) {
 	if l.Level < LevelExtreme {
 		return
 	}
-	l.Debug(format, v...)
+	l.line(LevelExtreme, format, v...)
 }
 
 func (l *Logger) Debug(format string, v ...interface{}) {
 	if l.Level < LevelDebug {
 		return
 	}
-	fpath := l.stackString()
-	msg := fmt.Sprintf(format, v...)
-	fmt.Fprintf(l.Stderr, l.DebugPrefix+fpath+": "+msg+"\n")
+	l.line(LevelDebug, format, v...)
 }
 func (l *Logger) Verbose(format string, v ...interface{}) {
 	if l.Level < LevelVerbose {
 		return
 	}
-	l.stderrPrint(format, v...)
+	l.line(LevelVerbose, format, v...)
 }
 func (l *Logger) Normal(format string, v ...interface{}) {
 	l.Log(format, v...)
@@ -77,26 +161,91 @@ func (l *Logger) Log(format string, v ...interface{}) {
 	if l.Level < LevelNormal {
 		return
 	}
-	l.stderrPrint(format, v...)
+	l.line(LevelNormal, format, v...)
 }
 func (l *Logger) Prompt(format string, v ...interface{}) {
 	if l.Level < LevelNormal {
 		return
 	}
+	outMu.Lock()
+	defer outMu.Unlock()
 	fmt.Fprintf(l.Stderr, format+": ", v...)
 }
 func (l *Logger) CmdOutput(format string, v ...interface{}) {
 	l.stdoutPrint(format, v...)
 }
+
+// Enter adds name to the call path shown in debug lines until the
+// returned function is called. The path is kept in the logger, so it's
+// only meaningful for work done one thing at a time; use EnterContext
+// for anything that runs concurrently.
 func (l *Logger) Enter(name string) func() {
+	outMu.Lock()
 	l.Stack = append(l.Stack, name)
+	outMu.Unlock()
 	l.Extreme("entering %s", name)
 	return func() {
 		if l.Level >= LevelExtreme {
 			l.Extreme("exiting %s", name)
 		}
-		l.Stack = l.Stack[:len(l.Stack)-1]
+		outMu.Lock()
+		if n := len(l.Stack); n > 0 {
+			l.Stack = l.Stack[:n-1]
+		}
+		outMu.Unlock()
+	}
+}
+
+type pathKey struct{}
+type fieldsKey struct{}
+
+// EnterContext is Enter for work that may run concurrently. The call
+// path is kept in the returned context instead of the logger, so each
+// goroutine can have its own; log through Context(ctx) to use it. The
+// path starts from the logger's own if ctx doesn't have one yet.
+func (l *Logger) EnterContext(ctx context.Context, name string) (context.Context, func()) {
+	path, ok := ctx.Value(pathKey{}).([]string)
+	if !ok {
+		path = l.stack()
+	}
+	// a new slice, so siblings entered from the same ctx don't share one
+	path = append(path[:len(path):len(path)], name)
+	ctx = context.WithValue(ctx, pathKey{}, path)
+
+	cl := l.Context(ctx)
+	cl.Extreme("entering %s", name)
+	return ctx, func() {
+		cl.Extreme("exiting %s", name)
+	}
+}
+
+// WithFields returns a context whose loggers, see Context, add the
+// key/value pairs kv to every line.
+func WithFields(ctx context.Context, kv ...interface{}) context.Context {
+	fields, _ := ctx.Value(fieldsKey{}).([]interface{})
+	fields = append(fields[:len(fields):len(fields)], kv...)
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
+// Context returns a copy of the logger that logs with ctx's call path
+// and fields.
+func (l *Logger) Context(ctx context.Context) *Logger {
+	c := *l
+	if path, ok := ctx.Value(pathKey{}).([]string); ok {
+		c.path = path
+	}
+	if fields, ok := ctx.Value(fieldsKey{}).([]interface{}); ok {
+		c.fields = append(c.fields[:len(c.fields):len(c.fields)], fields...)
 	}
+	return &c
+}
+
+// With returns a copy of the logger that adds the key/value pairs kv to
+// every line. In text format they only show up on debug lines.
+func (l *Logger) With(kv ...interface{}) *Logger {
+	c := *l
+	c.fields = append(c.fields[:len(c.fields):len(c.fields)], kv...)
+	return &c
 }
 
 func (l *Logger) IsLevelSilent() bool  { return l.Level == LevelSilent }
@@ -108,42 +257,142 @@ func (l *Logger) IsLevelExtreme() bool { return l.Level >= LevelExtreme }
 
 func (l *Logger) stdoutPrint(format string, v ...interface{}) {
 	msg := fmt.Sprintf(format, v...)
+	outMu.Lock()
+	defer outMu.Unlock()
 	fmt.Fprint(l.Stdout, msg+"\n")
 }
 
-func (l *Logger) stderrPrint(format string, v ...interface{}) {
-	fmt.Fprintf(l.Stderr, format+"\n", v...)
+// line writes one log line at level wherever it should go.
+func (l *Logger) line(level Level, format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+
+	outMu.Lock()
+	defer outMu.Unlock()
+	var b []byte
+	if l.Format == FormatJSON {
+		b = l.jsonLine(level, msg)
+	} else {
+		b = l.textLine(level, msg)
+	}
+	if l.LogFile != nil {
+		l.LogFile.Write(b)
+		if level > LevelNormal {
+			return
+		}
+	}
+	l.Stderr.Write(b)
 }
+
+func (l *Logger) textLine(level Level, msg string) []byte {
+	if level < LevelDebug {
+		return []byte(msg + "\n")
+	}
+	var buf bytes.Buffer
+	buf.WriteString(l.DebugPrefix + l.stackString() + ": " + msg)
+	for i := 0; i < len(l.fields); i += 2 {
+		fmt.Fprintf(&buf, " %v=%v", l.fields[i], fieldValue(l.fields, i+1))
+	}
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+func (l *Logger) jsonLine(level Level, msg string) []byte {
+	name := level.String()
+	if level == LevelNormal {
+		name = "info"
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	writeField := func(key string, value interface{}) {
+		if buf.Len() > 1 {
+			buf.WriteString(",")
+		}
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		buf.Write(k)
+		buf.WriteString(":")
+		buf.Write(v)
+	}
+	writeField("time", now().Format(time.RFC3339Nano))
+	writeField("level", name)
+	writeField("path", l.stackString())
+	writeField("msg", msg)
+	for i := 0; i < len(l.fields); i += 2 {
+		writeField(fmt.Sprint(l.fields[i]), fieldValue(l.fields, i+1))
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// fieldValue is kv[i], or a placeholder for a key with no value.
+func fieldValue(kv []interface{}, i int) interface{} {
+	if i >= len(kv) {
+		return "(missing)"
+	}
+	if err, ok := kv[i].(error); ok {
+		return err.Error()
+	}
+	return kv[i]
+}
+
+func (l *Logger) stack() []string {
+	if l.path != nil {
+		return l.path
+	}
+	outMu.Lock()
+	defer outMu.Unlock()
+	return append([]string{}, l.Stack...)
+}
+
 func (l *Logger) stackString() string {
-	fpath := strings.Join(l.Stack, ":")
+	var fpath string
+	if l.path != nil {
+		fpath = strings.Join(l.path, ":")
+	} else {
+		// line holds outMu
+		fpath = strings.Join(l.Stack, ":")
+	}
 	if fpath == "" {
 		fpath = "<top>"
 	}
 	return fpath
 }
-func getLevelFromEnv() Level {
-	switch os.Getenv("LOGLEVEL") {
-	case "silent":
-		return LevelSilent
-	case "verbose":
-		return LevelVerbose
-	case "debug":
-		return LevelDebug
-	case "extreme":
-		return LevelExtreme
-	default:
-		return LevelNormal
+
+// LevelEnv is the environment variable the default logger's level is
+// read from, in the form ParseLevel takes.
+const LevelEnv = "LOGLEVEL"
+
+// FormatEnv is the environment variable the default logger's format is
+// read from.
+const FormatEnv = "LOGFORMAT"
+
+func newDefaultLogger() Logger {
+	l := New()
+	level, file, err := ParseLevel(os.Getenv(LevelEnv))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ignoring %s: %s\n", LevelEnv, err)
 	}
+	l.Level = level
+	if file != "" {
+		if err := l.OpenLogFile(file); err != nil {
+			fmt.Fprintf(os.Stderr, "ignoring %s: %s\n", LevelEnv, err)
+		}
+	}
+	if l.Format, err = ParseFormat(os.Getenv(FormatEnv)); err != nil {
+		fmt.Fprintf(os.Stderr, "ignoring %s: %s\n", FormatEnv, err)
+	}
+	return l
 }
 
-var glog = Logger{
-	Stderr:      os.Stderr,
-	Stdout:      os.Stdout,
-	DebugPrefix: DefaultDebugPrefix,
-	Level:       getLevelFromEnv(),
-}
+var glog = newDefaultLogger()
 
-var DefaultLogger = glog
+// DefaultLogger is the logger every package logs through, so setting
+// its level or format applies everywhere.
+var DefaultLogger = &glog
 
 var CmdOutput = glog.CmdOutput
 var Debug = glog.Debug
@@ -2,7 +2,15 @@ package logger
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -116,3 +124,100 @@ func TestLoggerLevels(t *testing.T) {
 	assert.Equal(t, "", stderr.String())
 	clear()
 }
+
+func TestJSONFormat(t *testing.T) {
+	var stderr bytes.Buffer
+	log := Logger{Stderr: &stderr, Level: LevelDebug, Format: FormatJSON}
+	now = func() time.Time { return time.Date(2018, 10, 1, 12, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	defer log.Enter("pkg.Func")()
+	log.With("track", "abc", "n", 3, "err", errors.New("oops")).Debug("got %d", 3)
+	log.Log("hi \"there\"")
+
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Equal(t, `{"time":"2018-10-01T12:00:00Z","level":"debug","path":"pkg.Func","msg":"got 3","track":"abc","n":3,"err":"oops"}`, lines[0])
+
+	var line map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &line))
+	assert.Equal(t, "info", line["level"])
+	assert.Equal(t, `hi "there"`, line["msg"])
+}
+
+func TestTextFieldsOnlyOnDebug(t *testing.T) {
+	var stderr bytes.Buffer
+	log := Logger{Stderr: &stderr, Level: LevelDebug}
+	fielded := log.With("id", 1)
+	fielded.Log("normal")
+	fielded.Debug("debug")
+	assert.Equal(t, "normal\n<top>: debug id=1\n", stderr.String())
+}
+
+func TestLogFile(t *testing.T) {
+	var stderr, file bytes.Buffer
+	log := Logger{Stderr: &stderr, Level: LevelDebug, LogFile: &file}
+	log.Debug("debug")
+	log.Verbose("verbose")
+	log.Log("normal")
+
+	// the terminal only gets what it would have without --debug
+	assert.Equal(t, "normal\n", stderr.String())
+	assert.Equal(t, "<top>: debug\nverbose\nnormal\n", file.String())
+}
+
+func TestContextPaths(t *testing.T) {
+	var stderr bytes.Buffer
+	log := Logger{Stderr: &stderr, Level: LevelDebug}
+	defer log.Enter("outer")()
+
+	ctx, done := log.EnterContext(context.Background(), "worker")
+	defer done()
+
+	// concurrent work gets its own path, and the logger's own is left alone
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, done := log.EnterContext(WithFields(ctx, "i", i), fmt.Sprintf("job%d", i))
+			defer done()
+			log.Context(ctx).Debug("working")
+		}(i)
+	}
+	wg.Wait()
+	log.Debug("done")
+
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	sort.Strings(lines[:2])
+	assert.Equal(t, []string{
+		"outer:worker:job0: working i=0",
+		"outer:worker:job1: working i=1",
+		"outer: done",
+	}, lines)
+}
+
+func TestParseLevel(t *testing.T) {
+	for in, want := range map[string]struct {
+		level Level
+		file  string
+	}{
+		"":                   {LevelNormal, ""},
+		"debug":              {LevelDebug, ""},
+		"extreme:/tmp/x.log": {LevelExtreme, "/tmp/x.log"},
+		":/tmp/x.log":        {LevelNormal, "/tmp/x.log"},
+	} {
+		level, file, err := ParseLevel(in)
+		assert.NoError(t, err, in)
+		assert.Equal(t, want.level, level, in)
+		assert.Equal(t, want.file, file, in)
+	}
+	_, _, err := ParseLevel("loud")
+	assert.Error(t, err)
+
+	format, err := ParseFormat("json")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatJSON, format)
+	_, err = ParseFormat("xml")
+	assert.Error(t, err)
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/brianloveswords/spotify/auth"
+	"github.com/brianloveswords/spotify/favs"
 	"github.com/brianloveswords/spotify/logger"
 	"github.com/brianloveswords/spotify/mix"
+	"github.com/brianloveswords/spotify/output"
+	"github.com/brianloveswords/spotify/profile"
+	"github.com/brianloveswords/spotify/show"
+	"github.com/brianloveswords/spotify/songkick"
 	"github.com/brianloveswords/spotify/util"
 	"github.com/fatih/color"
 	"github.com/urfave/cli"
@@ -15,18 +24,56 @@ import (
 var glog = logger.DefaultLogger
 
 func mainFav(c *cli.Context) error {
-	client := auth.SetupClient()
-	playing, err := client.PlayerCurrentlyPlaying()
+	httpClient := auth.SetupHTTPClient()
+	now := mustLoadPlaying(httpClient, show.KindTrack, show.KindEpisode)
+
+	if now.Kind == show.KindEpisode {
+		if err := show.SaveEpisode(httpClient, now.Episode.ID); err != nil {
+			glog.Fatal("%s", err)
+		}
+	} else {
+		client := spotify.NewClient(httpClient)
+		if err := client.AddTracksToLibrary(now.Track.ID); err != nil {
+			glog.Fatal("could add track to library: %s", err)
+		}
+	}
+	glog.Log("adding to library: %s", color.CyanString(now.String()))
+	return nil
+}
+
+// Exit codes for when what's playing isn't something a command can
+// work with, so scripts can tell those apart from failures, which exit
+// with 1.
+var kindExitCodes = map[show.Kind]int{
+	show.KindIdle:    2,
+	show.KindAd:      3,
+	show.KindEpisode: 4,
+	show.KindTrack:   5,
+	show.KindUnknown: 6,
+}
+
+// exitForKind exits with the code for the kind in err if it's a
+// show.KindError, and like glog.Fatal otherwise.
+func exitForKind(err error) {
+	kerr, ok := err.(*show.KindError)
+	if !ok {
+		glog.Fatal("%s", err)
+	}
+	glog.Log("%s", kerr)
+	os.Exit(kindExitCodes[kerr.Kind])
+}
+
+// mustLoadPlaying returns what's playing, exiting if it isn't one of
+// kinds.
+func mustLoadPlaying(client show.Client, kinds ...show.Kind) *show.NowPlaying {
+	now, err := show.Load(client)
 	if err != nil {
-		glog.Fatal("could not get currently playing: %s", err)
+		glog.Fatal("%s", err)
 	}
-	track := playing.Item
-	if err := client.AddTracksToLibrary(track.ID); err != nil {
-		glog.Fatal("could add track to library: %s", err)
+	if err := now.Require(kinds...); err != nil {
+		exitForKind(err)
 	}
-	name := util.SongAttributionFromTrack(track)
-	glog.Log("adding to library: %s", color.CyanString(name))
-	return nil
+	return now
 }
 
 func mainPlay(c *cli.Context) error {
@@ -53,7 +100,7 @@ func mainPause(c *cli.Context) error {
 func mainNext(c *cli.Context) error {
 	client := auth.SetupClient()
 	if err := client.Next(); err != nil {
-		glog.Fatal("couldn't skip track: ", err)
+		glog.Fatal("couldn't skip track: %s", err)
 	}
 	util.LogCurrentTrack(client, glog, "skipping")
 	return nil
@@ -61,82 +108,533 @@ func mainNext(c *cli.Context) error {
 func mainPrev(c *cli.Context) error {
 	client := auth.SetupClient()
 	if err := client.Previous(); err != nil {
-		glog.Fatal("couldn't go back: ", err)
+		glog.Fatal("couldn't go back: %s", err)
 	}
 	util.LogCurrentTrack(client, glog, "going back to")
 	return nil
 }
 
-func showPlaying(c *cli.Context) error {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient(), glog)
-	name := util.SongAttributionFromTrack(track)
-	glog.CmdOutput("current track: %s", color.CyanString(name))
+// mustGetPlayerState returns the state of the player, which seek and
+// the like need to work relative to.
+func mustGetPlayerState(client util.Player) *spotify.PlayerState {
+	state, err := client.PlayerState()
+	if err != nil {
+		glog.Fatal("couldn't get player state: %s", err)
+	}
+	if state == nil || state.Device.ID == "" {
+		exitForKind(&show.KindError{Kind: show.KindIdle})
+	}
+	return state
+}
+
+func mainSeek(c *cli.Context) error {
+	if c.NArg() != 1 {
+		glog.Fatal("expected a position, like 1:30, 90 or +10")
+	}
+	client := auth.SetupClient()
+	state := mustGetPlayerState(client)
+	to, err := util.ParseSeek(c.Args().First(), time.Duration(state.Progress)*time.Millisecond)
+	if err != nil {
+		glog.Fatal("%s", err)
+	}
+	if err := client.Seek(int(to / time.Millisecond)); err != nil {
+		glog.Fatal("couldn't seek: %s", err)
+	}
+	util.LogCurrentTrack(client, glog, "seeking to "+util.FormatDuration(to)+" in")
 	return nil
 }
-func showArtist(c *cli.Context) error {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient(), glog)
-	glog.CmdOutput(track.Artists[0].Name)
+
+func mainVolume(c *cli.Context) error {
+	client := auth.SetupClient()
+	state := mustGetPlayerState(client)
+	if c.NArg() == 0 {
+		glog.CmdOutput("%d", state.Device.Volume)
+		return nil
+	}
+	volume, err := util.ParseVolume(c.Args().First(), state.Device.Volume)
+	if err != nil {
+		glog.Fatal("%s", err)
+	}
+	if err := client.Volume(volume); err != nil {
+		glog.Fatal("couldn't set volume: %s", err)
+	}
+	util.LogCurrentTrack(client, glog, fmt.Sprintf("volume %d%%:", volume))
 	return nil
 }
-func showArtistID(c *cli.Context) error {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient(), glog)
-	glog.CmdOutput("%s", track.Artists[0].ID)
+
+func mainShuffle(c *cli.Context) error {
+	arg := "toggle"
+	if c.NArg() > 0 {
+		arg = c.Args().First()
+	}
+	client := auth.SetupClient()
+	state := mustGetPlayerState(client)
+	shuffle, err := util.ParseShuffle(arg, state.ShuffleState)
+	if err != nil {
+		glog.Fatal("%s", err)
+	}
+	if err := client.Shuffle(shuffle); err != nil {
+		glog.Fatal("couldn't set shuffle: %s", err)
+	}
+	if shuffle {
+		util.LogCurrentTrack(client, glog, "shuffle on:")
+	} else {
+		util.LogCurrentTrack(client, glog, "shuffle off:")
+	}
 	return nil
 }
-func showArtistURI(c *cli.Context) error {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient(), glog)
-	uri := track.Artists[0].URI
-	glog.CmdOutput("%s", uri)
+
+func mainRepeat(c *cli.Context) error {
+	repeat, err := util.ParseRepeat(c.Args().First())
+	if err != nil {
+		glog.Fatal("%s", err)
+	}
+	client := auth.SetupClient()
+	if err := client.Repeat(repeat); err != nil {
+		glog.Fatal("couldn't set repeat: %s", err)
+	}
+	util.LogCurrentTrack(client, glog, "repeat "+repeat+":")
+	return nil
+}
+
+func mainDevices(c *cli.Context) error {
+	client := auth.SetupClient()
+	devices, err := client.PlayerDevices()
+	if err != nil {
+		glog.Fatal("couldn't get devices: %s", err)
+	}
+	for _, d := range devices {
+		mark := " "
+		if d.Active {
+			mark = "*"
+		}
+		text := fmt.Sprintf("%s %s (%s, %d%%)", mark, d.Name, d.Type, d.Volume)
+		writeOutput(output.Fields(
+			"name", d.Name,
+			"id", d.ID,
+			"type", d.Type,
+			"volume_percent", d.Volume,
+			"is_active", d.Active,
+			"is_restricted", d.Restricted,
+		), text)
+	}
+	return nil
+}
+
+func mainTransfer(c *cli.Context) error {
+	if c.NArg() == 0 {
+		glog.Fatal("expected a device name, see %s", color.CyanString("devices"))
+	}
+	name := strings.Join(c.Args(), " ")
+	client := auth.SetupClient()
+	devices, err := client.PlayerDevices()
+	if err != nil {
+		glog.Fatal("couldn't get devices: %s", err)
+	}
+	device, err := util.FindDevice(devices, name)
+	if err != nil {
+		glog.Fatal("%s", err)
+	}
+	if err := client.TransferPlayback(device.ID, c.Bool("play")); err != nil {
+		glog.Fatal("couldn't transfer playback: %s", err)
+	}
+	util.LogCurrentTrack(client, glog, "moving to "+device.Name+":")
+	return nil
+}
+
+// out writes what the info commands find, in the format picked with
+// --output or --format.
+var out *output.Writer
+
+func writeOutput(r output.Record, text string) {
+	if err := out.Write(r, text); err != nil {
+		glog.Fatal("%s", err)
+	}
+}
+
+// showNow prints the fields of what's playing picked with --field, or
+// everything if none were.
+func showNow(c *cli.Context) error {
+	return showFields(c, c.StringSlice("field")...)
+}
+
+// showFields prints the named fields of what's playing, one per line in
+// text, and with --open opens the first URI among them in spotify. With
+// no fields it prints the whole record, or a summary in text.
+func showFields(c *cli.Context, fields ...string) error {
+	defer glog.Enter("showFields")()
+
+	now, err := show.Load(auth.SetupHTTPClient())
+	if err != nil {
+		glog.Fatal("%s", err)
+	}
+	r, err := now.Select(fields...)
+	if _, ok := err.(*show.KindError); ok {
+		exitForKind(err)
+	} else if err != nil {
+		glog.Fatal("%s (fields are %s)", err, strings.Join(show.Fields, ", "))
+	}
+
+	text := fmt.Sprintf("current %s: %s", now.Kind, color.CyanString(now.String()))
+	if len(fields) > 0 {
+		lines := make([]string, len(r))
+		for i, f := range r {
+			lines[i] = textValue(f.Value)
+		}
+		text = strings.Join(lines, "\n")
+	}
+	writeOutput(r, text)
 
 	if c.Bool("open") {
-		util.OpenURL(string(uri), false)
+		for _, f := range r {
+			if uri, ok := f.Value.(spotify.URI); ok {
+				util.OpenURL(string(uri), false)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func textValue(v interface{}) string {
+	if list, ok := v.([]string); ok {
+		return strings.Join(list, ", ")
+	}
+	return fmt.Sprint(v)
+}
+
+// showField is the action for one of the single field commands, like
+// track-id, which are kept as shorthand for now --field.
+func showField(name string) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		return showFields(c, name)
+	}
+}
+
+func mainShows(c *cli.Context) error {
+	defer glog.Enter("mainShows")()
+	var (
+		top   = c.Int("top")
+		metro = c.String("metro")
+		days  = c.Int("days")
+		now   = time.Now()
+	)
+
+	glog.Debug("top %d", top)
+	glog.Debug("metro %q", metro)
+	glog.Debug("days %d", days)
+
+	// cron jobs and the like can't answer questions, so park anything
+	// ambiguous in the review queue instead
+	interactive := !c.Bool("no-prompt") && !glog.IsLevelSilent()
+
+	artists, err := favs.TopArtists(auth.SetupClient(), top)
+	if err != nil {
+		glog.Fatal("couldn't get artists from library: %s", err)
 	}
+	if err := favs.LookupSongkickIDs(songkick.DefaultClient, artists, interactive); err != nil {
+		glog.Fatal("couldn't look up songkick IDs: %s", err)
+	}
+
+	// songkick dates are whole days, so start the window at midnight
+	// to keep tonight's shows in
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	shows := favs.UpcomingShows(songkick.DefaultClient, artists, favs.ShowFilter{
+		Metro: metro,
+		From:  from,
+		Until: from.AddDate(0, 0, days),
+	})
 
+	if len(shows) == 0 {
+		glog.Log("no upcoming shows found")
+		return nil
+	}
+	for _, show := range shows {
+		glog.CmdOutput("%s\t%s\t%s\t%s",
+			show.Date.Format("2006-01-02"),
+			show.Artist.Name,
+			show.Location,
+			show.URL,
+		)
+	}
 	return nil
 }
-func showTrack(c *cli.Context) error {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient(), glog)
-	glog.CmdOutput("%s", track.Name)
+
+func librarySync(c *cli.Context) error {
+	defer glog.Enter("librarySync")()
+	library, result, err := favs.SyncLibrary(auth.SetupClient(), c.Bool("full"))
+	if err != nil {
+		glog.Fatal("couldn't sync library: %s", err)
+	}
+
+	kind := "incremental"
+	if result.Full {
+		kind = "full"
+	}
+	glog.Log("%s sync: %s added, %s removed, %d tracks total",
+		kind,
+		color.GreenString("%d", result.Added),
+		color.RedString("%d", result.Removed),
+		len(library.Tracks),
+	)
 	return nil
 }
-func showTrackID(c *cli.Context) error {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient(), glog)
-	glog.CmdOutput("%s", track.ID)
+
+func libraryStatus(c *cli.Context) error {
+	defer glog.Enter("libraryStatus")()
+	library, err := favs.LoadLibrary()
+	if err != nil {
+		glog.Fatal("couldn't load library: %s", err)
+	}
+
+	when := func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return t.Local().Format("2006-01-02 15:04:05")
+	}
+	glog.CmdOutput("tracks: %d", len(library.Tracks))
+	glog.CmdOutput("artists: %d", favs.CountArtists(library.Tracks))
+	glog.CmdOutput("last sync: %s", when(library.LastSync))
+	glog.CmdOutput("last full sync: %s", when(library.LastFullSync))
 	return nil
 }
-func showTrackURI(c *cli.Context) error {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient(), glog)
-	glog.CmdOutput("%s", track.URI)
 
-	if c.Bool("open") {
-		util.OpenURL(string(track.URI), false)
+func songkickReview(c *cli.Context) error {
+	defer glog.Enter("songkickReview")()
+	if !c.Bool("list") {
+		if err := favs.ReviewSongkickIDs(); err != nil {
+			glog.Fatal("couldn't review songkick IDs: %s", err)
+		}
+		return nil
+	}
+
+	queue, err := favs.ReviewQueue()
+	if err != nil {
+		glog.Fatal("couldn't load review queue: %s", err)
+	}
+	for _, p := range queue {
+		glog.CmdOutput("%s\t%d candidates", p.Artist, len(p.Candidates))
 	}
 	return nil
 }
-func showAlbum(c *cli.Context) error {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient(), glog)
-	glog.CmdOutput("%s", track.Album.Name)
+
+func songkickSet(c *cli.Context) error {
+	defer glog.Enter("songkickSet")()
+	var (
+		artist = c.Args().Get(0)
+		rawID  = c.Args().Get(1)
+	)
+	if artist == "" || rawID == "" {
+		glog.Fatal("usage: songkick set <artist> <songkick-id>")
+	}
+	id, err := strconv.Atoi(rawID)
+	if err != nil || id <= 0 {
+		glog.Fatal("invalid songkick ID %s, must be a positive int", rawID)
+	}
+	if err := favs.SetSongkickID(artist, id); err != nil {
+		glog.Fatal("couldn't set songkick ID for %s: %s", artist, err)
+	}
+	glog.Log("set songkick ID for %s to %d", color.CyanString(artist), id)
 	return nil
 }
-func showAlbumID(c *cli.Context) error {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient(), glog)
-	glog.CmdOutput("%s", track.Album.ID)
+
+func songkickUnset(c *cli.Context) error {
+	defer glog.Enter("songkickUnset")()
+	artist := c.Args().Get(0)
+	if artist == "" {
+		glog.Fatal("usage: songkick unset <artist>")
+	}
+	if err := favs.UnsetSongkickID(artist); err != nil {
+		glog.Fatal("couldn't unset songkick ID for %s: %s", artist, err)
+	}
+	glog.Log("forgot songkick ID for %s", color.CyanString(artist))
 	return nil
 }
-func showAlbumURI(c *cli.Context) error {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient(), glog)
-	glog.CmdOutput("%s", track.Album.URI)
 
-	if c.Bool("open") {
-		util.OpenURL(string(track.Album.URI), false)
+func authLogin(c *cli.Context) error {
+	defer glog.Enter("authLogin")()
+	opts := auth.DefaultLoginOptions()
+	if c.IsSet("headless") {
+		opts.Headless = c.Bool("headless")
+	}
+	if port := c.Int("port"); port != 0 {
+		opts.RedirectURL = auth.RedirectURLForPort(port)
+	}
+	if u := c.String("redirect-url"); u != "" {
+		opts.RedirectURL = u
+	}
+	glog.Debug("login options %+v", opts)
+
+	tok, err := auth.Login(opts)
+	if err != nil {
+		glog.Fatal("couldn't log in: %s", err)
+	}
+	user, err := auth.NewClient(tok).CurrentUser()
+	if err != nil {
+		glog.Fatal("logged in but couldn't look up user: %s", err)
+	}
+	glog.Log("logged in as %s", color.CyanString(user.ID))
+	return nil
+}
+
+func authLogout(c *cli.Context) error {
+	defer glog.Enter("authLogout")()
+	if err := auth.Logout(); err != nil {
+		glog.Fatal("couldn't log out: %s", err)
+	}
+	glog.Log("logged out")
+	return nil
+}
+
+func authStatus(c *cli.Context) error {
+	defer glog.Enter("authStatus")()
+	dirs, err := profile.App(c.GlobalString("profile"))
+	if err != nil {
+		glog.Fatal("%s", err)
+	}
+	client, tok, err := auth.ClientFor(dirs)
+	if err == auth.ErrNotLoggedIn {
+		glog.Fatal("not logged in, see %s", color.CyanString("auth login"))
+	}
+	if err != nil {
+		glog.Fatal("couldn't load token: %s", err)
+	}
+
+	user, err := client.CurrentUser()
+	if err != nil {
+		glog.Fatal("couldn't look up user: %s", err)
+	}
+
+	expiry := tok.Expiry.Local().Format("2006-01-02 15:04:05")
+	if tok.Expiry.Before(time.Now()) {
+		expiry += " (expired, refreshed on next use)"
+	}
+	glog.CmdOutput("user: %s (%s)", user.DisplayName, user.ID)
+	granted, err := auth.GrantedScopes()
+	if err != nil {
+		glog.Fatal("couldn't read granted scopes: %s", err)
+	}
+	if granted == nil {
+		glog.CmdOutput("scopes: %s (requested, what was granted is known after the next refresh)", strings.Join(auth.Scopes(), " "))
+	} else {
+		glog.CmdOutput("scopes: %s", strings.Join(granted, " "))
+	}
+	if missing, _ := auth.MissingScopes(); len(missing) > 0 {
+		glog.CmdOutput("missing: %s (see %s)", strings.Join(missing, " "), color.CyanString("auth login"))
+	}
+	glog.CmdOutput("expires: %s", expiry)
+	return nil
+}
+
+func authList(c *cli.Context) error {
+	defer glog.Enter("authList")()
+	current := c.GlobalString("profile")
+	if current == "" {
+		current = profile.Default
+	}
+
+	names, err := profile.List()
+	if err != nil {
+		glog.Fatal("%s", err)
+	}
+	for _, name := range names {
+		mark := " "
+		if name == current {
+			mark = "*"
+		}
+		glog.CmdOutput("%s %s\t%s", mark, name, profileUser(name))
+	}
+	return nil
+}
+
+// profileUser describes who's logged in to the profile name.
+func profileUser(name string) string {
+	dirs, err := profile.App(name)
+	if err != nil {
+		return err.Error()
+	}
+	client, _, err := auth.ClientFor(dirs)
+	if err == auth.ErrNotLoggedIn {
+		return "not logged in"
+	}
+	if err != nil {
+		return fmt.Sprintf("couldn't load token: %s", err)
+	}
+	user, err := client.CurrentUser()
+	if err != nil {
+		return fmt.Sprintf("couldn't look up user: %s", err)
+	}
+	return fmt.Sprintf("%s (%s)", color.CyanString(user.DisplayName), user.ID)
+}
+
+func authExport(c *cli.Context) error {
+	defer glog.Enter("authExport")()
+	out := os.Stdout
+	if name := c.Args().Get(0); name != "" && name != "-" {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			glog.Fatal("couldn't create %s: %s", name, err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := auth.Export(out); err != nil {
+		glog.Fatal("couldn't export token: %s", err)
 	}
 	return nil
 }
 
+func authImport(c *cli.Context) error {
+	defer glog.Enter("authImport")()
+	in := os.Stdin
+	if name := c.Args().Get(0); name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			glog.Fatal("couldn't open %s: %s", name, err)
+		}
+		defer f.Close()
+		in = f
+	}
+	if _, err := auth.Import(in); err != nil {
+		glog.Fatal("couldn't import token: %s", err)
+	}
+	glog.Log("imported token")
+	return nil
+}
+
+// debugFlag is --debug, which is on when given bare and logs to a file
+// when given one, as in --debug=FILE.
+type debugFlag struct {
+	on   bool
+	file string
+}
+
+func (f *debugFlag) IsBoolFlag() bool { return true }
+
+func (f *debugFlag) Set(s string) error {
+	switch s {
+	case "true":
+		f.on = true
+	case "false":
+		f.on = false
+	default:
+		f.on, f.file = true, s
+	}
+	return nil
+}
+
+func (f *debugFlag) String() string {
+	if f.file != "" {
+		return f.file
+	}
+	return strconv.FormatBool(f.on)
+}
+
 func main() {
 	app := cli.NewApp()
-	app.Writer = &glog
-	app.ErrWriter = &glog
+	app.Writer = glog
+	app.ErrWriter = glog
 	app.Version = "1.0.0"
 
 	flagMixLength := cli.IntFlag{
@@ -158,27 +656,73 @@ func main() {
 			Name:  "verbose",
 			Usage: "output additional information while running commands",
 		},
-		cli.BoolFlag{
+		cli.GenericFlag{
 			Name:  "debug",
-			Usage: "output debugging information while running commands",
+			Usage: "output debugging information while running commands, or with --debug=FILE write it to FILE",
+			Value: &debugFlag{},
+		},
+		cli.StringFlag{
+			Name:   "log-format",
+			Usage:  "write log lines as text or json",
+			Value:  "text",
+			EnvVar: logger.FormatEnv,
+		},
+		cli.StringFlag{
+			Name:  "output",
+			Usage: "print track information as text, json or tsv",
+			Value: "text",
+		},
+		cli.StringFlag{
+			Name:  "format",
+			Usage: "print track information with a Go template, like '{{.artist}} - {{.track}}'",
+		},
+		cli.StringFlag{
+			Name:   "profile",
+			Usage:  "use a separate login, cache and config, for another spotify account",
+			EnvVar: profile.Env,
 		},
 	}
 	app.Before = func(c *cli.Context) error {
 		if c.Bool("verbose") {
 			glog.Level = logger.LevelVerbose
 		}
-		if c.Bool("debug") {
+		if debug := c.Generic("debug").(*debugFlag); debug.on {
 			glog.Level = logger.LevelDebug
+			if debug.file != "" {
+				if err := glog.OpenLogFile(debug.file); err != nil {
+					glog.Fatal("%s", err)
+				}
+			}
+		}
+		format, err := logger.ParseFormat(c.String("log-format"))
+		if err != nil {
+			glog.Fatal("%s", err)
 		}
+		glog.Format = format
 		if c.Bool("silent") {
 			glog.Level = logger.LevelSilent
 		}
+
+		outputFormat, err := output.ParseFormat(c.String("output"))
+		if err != nil {
+			glog.Fatal("%s", err)
+		}
+		if out, err = output.New(glog.Stdout, outputFormat, c.String("format")); err != nil {
+			glog.Fatal("%s", err)
+		}
+
+		dirs, err := profile.App(c.String("profile"))
+		if err != nil {
+			glog.Fatal("%s", err)
+		}
+		auth.UseApp(dirs)
+		favs.UseApp(dirs)
 		return nil
 	}
 	app.Commands = []cli.Command{
 		{
 			Name:   "fav",
-			Usage:  "add current song to library",
+			Usage:  "add current song or podcast episode to library",
 			Action: mainFav,
 		},
 		{
@@ -207,67 +751,129 @@ func main() {
 			Usage:    "prev the current song",
 			Action:   mainPrev,
 		},
+		{
+			Name:            "seek",
+			Category:        "play control",
+			Usage:           "jump to a point in the current song",
+			ArgsUsage:       "<seconds|m:ss|+seconds|-seconds>",
+			Action:          mainSeek,
+			SkipFlagParsing: true,
+		},
+		{
+			Name:            "volume",
+			Category:        "play control",
+			Usage:           "show or set the volume",
+			ArgsUsage:       "[0-100|+n|-n]",
+			Action:          mainVolume,
+			SkipFlagParsing: true,
+		},
+		{
+			Name:      "shuffle",
+			Category:  "play control",
+			Usage:     "turn shuffle on or off",
+			ArgsUsage: "[on|off|toggle]",
+			Action:    mainShuffle,
+		},
+		{
+			Name:      "repeat",
+			Category:  "play control",
+			Usage:     "set whether the song or playlist repeats",
+			ArgsUsage: "off|track|context",
+			Action:    mainRepeat,
+		},
+		{
+			Name:     "devices",
+			Category: "play control",
+			Usage:    "list the devices spotify can play on, marking the active one",
+			Action:   mainDevices,
+		},
+		{
+			Name:      "transfer",
+			Category:  "play control",
+			Usage:     "move playback to another device",
+			ArgsUsage: "<device-name>",
+			Action:    mainTransfer,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "play",
+					Usage: "start playing on the device, even if paused",
+				},
+			},
+		},
+		{
+			Name:     "now",
+			Category: "track information",
+			Usage:    "show what's playing, or just the fields picked with --field",
+			Action:   showNow,
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "field, f",
+					Usage: "show only `FIELD`, one of " + strings.Join(show.Fields, ", ") + "; can be repeated",
+				},
+				flagOpen,
+			},
+		},
 		{
 			Name:     "info",
 			Category: "track information",
 			Usage:    "display current song",
-			Action:   showPlaying,
+			Action:   showNow,
 		},
 		{
 			Name:     "track",
 			Category: "track information",
 			Usage:    "show the name of the current song",
-			Action:   showTrack,
+			Action:   showField("track"),
 		},
 		{
 			Name:     "track-id",
 			Category: "track information",
 			Usage:    "show the ID of the current song",
-			Action:   showTrackID,
+			Action:   showField("track_id"),
 		},
 		{
 			Name:     "track-uri",
 			Category: "track information",
 			Usage:    "show the URI of the current song",
-			Action:   showTrackURI,
+			Action:   showField("track_uri"),
 			Flags:    []cli.Flag{flagOpen},
 		},
 		{
 			Name:     "artist",
 			Category: "track information",
 			Usage:    "show the name of the current artist",
-			Action:   showArtist,
+			Action:   showField("artist"),
 		},
 		{
 			Name:     "artist-id",
 			Category: "track information",
 			Usage:    "show the ID of the current artist",
-			Action:   showArtistID,
+			Action:   showField("artist_id"),
 		},
 		{
 			Name:     "artist-uri",
 			Category: "track information",
 			Usage:    "show the spotify URI of the current artist",
-			Action:   showArtistURI,
+			Action:   showField("artist_uri"),
 			Flags:    []cli.Flag{flagOpen},
 		},
 		{
 			Name:     "album",
 			Category: "track information",
 			Usage:    "show the name of the current album",
-			Action:   showAlbum,
+			Action:   showField("album"),
 		},
 		{
 			Name:     "album-id",
 			Category: "track information",
 			Usage:    "show the ID of the current album",
-			Action:   showAlbumID,
+			Action:   showField("album_id"),
 		},
 		{
 			Name:     "album-uri",
 			Category: "track information",
 			Usage:    "show the spotify URI of the current album",
-			Action:   showAlbumURI,
+			Action:   showField("album_uri"),
 			Flags:    []cli.Flag{flagOpen},
 		},
 		{
@@ -307,6 +913,171 @@ func main() {
 							Usage: "what to call the playlist",
 							Value: "{mix} :ARTIST:",
 						},
+						cli.StringFlag{
+							Name:  "include",
+							Usage: "which releases to pull tracks from: album, single, compilation, appears_on or all",
+							Value: "album,single",
+						},
+					},
+				},
+			},
+		},
+		{
+			Name:   "shows",
+			Usage:  "list upcoming shows for the artists in your library",
+			Action: mainShows,
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "top, n",
+					Usage: "how many artists to check, by number of saved tracks",
+					Value: 50,
+				},
+				cli.StringFlag{
+					Name:   "metro",
+					Usage:  "only show events whose location contains this, e.g. \"Brooklyn\"",
+					EnvVar: "SPOTIFY_METRO",
+				},
+				cli.IntFlag{
+					Name:  "days",
+					Usage: "how many days ahead to look",
+					Value: 90,
+				},
+				cli.BoolFlag{
+					Name:  "no-prompt",
+					Usage: "queue unclear songkick matches for \"songkick review\" instead of asking",
+				},
+			},
+		},
+		{
+			Name:  "auth",
+			Usage: "commands for managing the spotify login",
+			Subcommands: []cli.Command{
+				{
+					Name:   "login",
+					Usage:  "log in to spotify, replacing any saved login",
+					Action: authLogin,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:   "headless",
+							Usage:  "print the login URL and read back the URL you're redirected to, instead of opening a browser. on by default over SSH or without a display",
+							EnvVar: "SPOTIFY_HEADLESS",
+						},
+						cli.IntFlag{
+							Name:  "port",
+							Usage: "listen for the login redirect on this port instead of 8888. http://localhost:<port> must be a registered redirect URL",
+						},
+						cli.StringFlag{
+							Name:   "redirect-url",
+							Usage:  "use this registered redirect URL, listening on its port",
+							EnvVar: "SPOTIFY_REDIRECT_URL",
+						},
+					},
+				},
+				{
+					Name:   "logout",
+					Usage:  "delete the saved login",
+					Action: authLogout,
+				},
+				{
+					Name:   "status",
+					Usage:  "show who's logged in, with what scopes and until when",
+					Action: authStatus,
+				},
+				{
+					Name:   "list",
+					Usage:  "show the profiles and who's logged in to each",
+					Action: authList,
+				},
+				{
+					Name:      "export",
+					Usage:     "write the saved login, encrypted with a passphrase, to a file or stdout to import on another machine",
+					ArgsUsage: "[outfile=-]",
+					Action:    authExport,
+				},
+				{
+					Name:      "import",
+					Usage:     "read a login written by export from a file or stdin and save it",
+					ArgsUsage: "[infile=-]",
+					Action:    authImport,
+				},
+			},
+		},
+		{
+			Name:  "library",
+			Usage: "commands for the local copy of your saved tracks",
+			Subcommands: []cli.Command{
+				{
+					Name:   "sync",
+					Usage:  "fetch tracks saved since the last sync",
+					Action: librarySync,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "full",
+							Usage: "fetch the whole library, which also picks up removed tracks",
+						},
+					},
+				},
+				{
+					Name:   "status",
+					Usage:  "show how many tracks are synced and when",
+					Action: libraryStatus,
+				},
+			},
+		},
+		{
+			Name:  "songkick",
+			Usage: "commands for managing artist songkick IDs",
+			Subcommands: []cli.Command{
+				{
+					Name:   "review",
+					Usage:  "pick songkick IDs for artists that couldn't be matched automatically",
+					Action: songkickReview,
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "list",
+							Usage: "only list the artists waiting for review",
+						},
+					},
+				},
+				{
+					Name:      "set",
+					Usage:     "set the songkick ID for an artist",
+					ArgsUsage: "<artist-name|spotify-artist-id> <songkick-id>",
+					Action:    songkickSet,
+				},
+				{
+					Name:      "unset",
+					Usage:     "forget the songkick ID for an artist so it's looked up again",
+					ArgsUsage: "<artist-name|spotify-artist-id>",
+					Action:    songkickUnset,
+				},
+			},
+		},
+		{
+			Name:  "playlist",
+			Usage: "commands for creating playlists",
+			Subcommands: []cli.Command{
+				{
+					Name:      "from-url",
+					Usage:     "create playlist from the line-up of a songkick concert",
+					ArgsUsage: "<songkick-concert-url>",
+					Action:    playlistFromURL,
+					Flags: []cli.Flag{
+						flagOpen,
+						cli.StringFlag{
+							Name:  "tracks",
+							Usage: "which tracks to use from each artist: latest, random or all",
+							Value: string(mix.TracksLatest),
+						},
+						cli.IntFlag{
+							Name:  "length, l",
+							Usage: "how many tracks to include per artist with --tracks=random",
+							Value: 10,
+						},
+						cli.StringFlag{
+							Name:  "name",
+							Usage: "what to call the playlist (default: the line-up)",
+						},
 					},
 				},
 			},
@@ -330,11 +1101,13 @@ func mixTrack(c *cli.Context) error {
 	glog.Debug("name %q", name)
 	glog.Debug("length %q", length)
 
+	httpClient := auth.SetupHTTPClient()
+	client := spotify.NewClient(httpClient)
+	trackID := spotify.ID(track)
 	if track == "" {
-		playlist, err = mix.ByCurrentTrack(glog, name, length)
-	} else {
-		playlist, err = mix.ByTrackID(glog, spotify.ID(track), name, length)
+		trackID = mustLoadPlaying(httpClient, show.KindTrack).Track.ID
 	}
+	playlist, err = mix.ByTrackID(glog, &client, trackID, name, length)
 	if err != nil {
 		glog.Fatal(err.Error())
 	}
@@ -359,22 +1132,80 @@ func mixArtist(c *cli.Context) error {
 		isID     = c.Bool("id")
 	)
 
+	types, err := util.ParseAlbumTypes(c.String("include"))
+	if err != nil {
+		glog.Fatal(err.Error())
+	}
+
 	glog.Debug("artist %q", name)
 	glog.Debug("name %q", name)
 	glog.Debug("length %q", length)
 
+	if artist == "" && isID {
+		glog.Fatal("must pass an artist ID when using --id flag")
+	}
+
+	httpClient := auth.SetupHTTPClient()
+	client := spotify.NewClient(httpClient)
 	if artist == "" {
-		if isID {
-			glog.Fatal("must pass an artist ID when using --id flag")
-		}
-		playlist, err = mix.ByCurrentArtist(glog, name, length)
+		now := mustLoadPlaying(httpClient, show.KindTrack)
+		playlist, err = mix.ByArtistID(glog, &client, now.Artists[0].ID, name, length, types)
+	} else if isID {
+		playlist, err = mix.ByArtistID(glog, &client, spotify.ID(artist), name, length, types)
 	} else {
-		if isID {
-			playlist, err = mix.ByArtistID(glog, spotify.ID(artist), name, length)
-		} else {
-			playlist, err = mix.ByArtist(glog, artist, name, length)
-		}
+		playlist, err = mix.ByArtist(glog, &client, artist, name, length, types)
+	}
+	if err != nil {
+		glog.Fatal(err.Error())
+	}
+
+	glog.Log("created %s", color.MagentaString(playlist.Name))
+	glog.CmdOutput("%s", playlist.URI)
+
+	if c.Bool("open") {
+		util.OpenURL(string(playlist.URI), false)
 	}
+	return nil
+}
+
+func playlistFromURL(c *cli.Context) error {
+	defer glog.Enter("playlistFromURL")()
+	var (
+		url    = c.Args().Get(0)
+		mode   = mix.TrackMode(c.String("tracks"))
+		length = c.Int("length")
+		name   = c.String("name")
+	)
+
+	glog.Debug("url %q", url)
+	glog.Debug("mode %q", mode)
+	glog.Debug("length %d", length)
+
+	if url == "" {
+		glog.Fatal("must pass a songkick concert URL")
+	}
+	if !songkick.IsConcertURL(url) {
+		glog.Fatal("don't know what to do with url %s", url)
+	}
+	if !mode.Valid() {
+		glog.Fatal("--tracks must be one of latest, random or all, got %q", mode)
+	}
+
+	glog.Verbose("creating playlist from page %s", color.YellowString(url))
+	artists, err := songkick.DefaultClient.Lineup(url)
+	if err != nil {
+		glog.Fatal("couldn't get line-up from %s: %s", url, err)
+	}
+	if len(artists) == 0 {
+		glog.Fatal("didn't find any artists on the line-up at %s", url)
+	}
+
+	if name == "" {
+		name = strings.Join(artists, "/")
+	}
+	glog.Log("creating playlist %s", color.CyanString(name))
+
+	playlist, err := mix.ByArtistNames(glog, auth.SetupClient(), artists, name, mode, length)
 	if err != nil {
 		glog.Fatal(err.Error())
 	}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/brianloveswords/spotify/auth"
+	"github.com/brianloveswords/spotify/spotifytest"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+	"github.com/zmb3/spotify"
+)
+
+// fakeAPI starts the fake spotify API and points the commands at it, the
+// way SPOTIFY_API_URL does for the CLI.
+func fakeAPI(t *testing.T) (*spotifytest.Server, func()) {
+	server := spotifytest.NewServer(spotifytest.DefaultFixtures())
+	old, had := os.LookupEnv(auth.APIURLEnv)
+	assert.NoError(t, os.Setenv(auth.APIURLEnv, server.APIURL()))
+	return server, func() {
+		if had {
+			os.Setenv(auth.APIURLEnv, old)
+		} else {
+			os.Unsetenv(auth.APIURLEnv)
+		}
+		server.Close()
+	}
+}
+
+// context returns a cli context for a command with flags run with args.
+func context(t *testing.T, flags []cli.Flag, args ...string) *cli.Context {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	for _, f := range flags {
+		f.Apply(set)
+	}
+	assert.NoError(t, set.Parse(args))
+	return cli.NewContext(nil, set, nil)
+}
+
+func TestFavSavesCurrentTrack(t *testing.T) {
+	server, done := fakeAPI(t)
+	defer done()
+
+	assert.NoError(t, mainFav(context(t, nil)))
+	saved := server.Saved()
+	assert.Equal(t, spotify.ID("anymore2"), saved[0].ID)
+}
+
+func TestPlayerCommands(t *testing.T) {
+	server, done := fakeAPI(t)
+	defer done()
+
+	assert.NoError(t, mainVolume(context(t, nil, "+20")))
+	assert.Equal(t, 70, server.PlayerState().Device.Volume)
+
+	assert.NoError(t, mainSeek(context(t, nil, "1:30")))
+	assert.Equal(t, 90000, server.PlayerState().Progress)
+
+	assert.NoError(t, mainPause(context(t, nil)))
+	_, playing := server.Player()
+	assert.False(t, playing)
+}
+
+func TestMixCurrentTrack(t *testing.T) {
+	server, done := fakeAPI(t)
+	defer done()
+
+	flags := []cli.Flag{
+		cli.IntFlag{Name: "length", Value: 5},
+		cli.StringFlag{Name: "name", Value: ":ARTIST: - :TRACK: mix"},
+	}
+	assert.NoError(t, mixTrack(context(t, flags)))
+	playlists := server.Playlists()
+	if assert.Len(t, playlists, 1) {
+		assert.Equal(t, "Gleemer - Down mix", playlists[0].Name)
+	}
+}
@@ -2,12 +2,14 @@ package mix
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 
-	"github.com/brianloveswords/spotify/auth"
+	"github.com/brianloveswords/spotify/fetch"
 	"github.com/brianloveswords/spotify/logger"
 	"github.com/brianloveswords/spotify/util"
 	"github.com/fatih/color"
@@ -16,9 +18,15 @@ import (
 
 var glog = logger.DefaultLogger
 
-func ByCurrentTrack(glog logger.Logger, name string, length int) (*spotify.FullPlaylist, error) {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient(), glog)
-	return ByTrackID(glog, track.ID, name, length)
+// Client is the part of the spotify client needed to make mixes.
+type Client interface {
+	util.Catalog
+	GetTrack(id spotify.ID) (*spotify.FullTrack, error)
+	GetArtist(id spotify.ID) (*spotify.FullArtist, error)
+	GetRecommendations(seeds spotify.Seeds, trackAttributes *spotify.TrackAttributes, opt *spotify.Options) (*spotify.Recommendations, error)
+	CurrentUser() (*spotify.PrivateUser, error)
+	CreatePlaylistForUser(userID, playlistName string, public bool) (*spotify.FullPlaylist, error)
+	AddTracksToPlaylist(userID string, playlistID spotify.ID, trackIDs ...spotify.ID) (snapshotID string, err error)
 }
 
 func processName(name string, artist *spotify.SimpleArtist, track *spotify.SimpleTrack) string {
@@ -31,9 +39,7 @@ func processName(name string, artist *spotify.SimpleArtist, track *spotify.Simpl
 	return name
 }
 
-func ByTrackID(glog logger.Logger, trackID spotify.ID, name string, length int) (*spotify.FullPlaylist, error) {
-	client := auth.SetupClient()
-
+func ByTrackID(glog *logger.Logger, client Client, trackID spotify.ID, name string, length int) (*spotify.FullPlaylist, error) {
 	seedTrack, err := client.GetTrack(trackID)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't find track for trackID %s: %s", trackID, err)
@@ -52,75 +58,49 @@ func ByTrackID(glog logger.Logger, trackID spotify.ID, name string, length int)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't get recommendations: %s", err)
 	}
-	tracks := recommendations.Tracks
-
-	user, err := client.CurrentUser()
-	if err != nil {
-		return nil, fmt.Errorf("couldn't access current user: %s", err)
-	}
-
-	playlist, err := client.CreatePlaylistForUser(user.ID, playlistName, true)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't create playlist for user %s: %s", user.ID, err)
-	}
-
-	for _, track := range tracks {
-		glog.Verbose("adding %s", color.CyanString(util.SongAttributionFromSimpleTrack(&track)))
-	}
-
-	_, err = client.AddTracksToPlaylist(user.ID, playlist.ID, util.TracksToIDs(tracks)...)
-	if err != nil {
-		// TODO: don't use color formatting here, use structured errors
-		return nil, fmt.Errorf("couldn't add tracks to playlist %s for user %s: %s",
-			color.BlueString(playlist.Name),
-			color.GreenString(user.ID),
-			err,
-		)
-	}
-	return playlist, nil
+	return createPlaylist(glog, client, playlistName, recommendations.Tracks)
 }
 
-func ByArtist(glog logger.Logger, artistName string, name string, length int) (*spotify.FullPlaylist, error) {
+func ByArtist(glog *logger.Logger, client Client, artistName string, name string, length int, types spotify.AlbumType) (*spotify.FullPlaylist, error) {
 	var artistID spotify.ID
-	client := auth.SetupClient()
 	normalizedArtist := strings.ToLower(artistName)
 
 	page, err := client.Search(artistName, spotify.SearchTypeArtist)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("couldn't search for artist %s: %s", artistName, err)
 	}
 
 	artists := page.Artists.Artists
 
 	if len(artists) == 0 {
-		glog.Fatal("could not find any matches for %s", color.BlueString(artistName))
+		return nil, fmt.Errorf("could not find any matches for %s", artistName)
 	}
 
 	if len(artists) == 1 {
 		artistID = artists[0].ID
-		return ByArtistID(glog, artistID, name, length)
+		return ByArtistID(glog, client, artistID, name, length, types)
 	}
 
 	for _, found := range artists {
 		if strings.ToLower(found.Name) == normalizedArtist {
 			artistID = found.ID
-			return ByArtistID(glog, artistID, name, length)
+			return ByArtistID(glog, client, artistID, name, length, types)
 		}
 	}
 
 	// okay we didn't find anything, let's get a user option?
-	// if it's silent, we can't prompt, so quit immediately
+	// if it's silent, we can't prompt, so give up immediately
 	if glog.IsLevelSilent() {
-		os.Exit(1)
+		return nil, fmt.Errorf("could not find an exact match for %s", artistName)
 	}
 
 	pick := promptForArtistSelection(artists)
 
 	if pick == nil {
-		os.Exit(1)
+		return nil, fmt.Errorf("no artist picked for %s", artistName)
 	}
 
-	return ByArtistID(glog, pick.ID, name, length)
+	return ByArtistID(glog, client, pick.ID, name, length, types)
 }
 
 func promptForArtistSelection(artists []spotify.FullArtist) *spotify.FullArtist {
@@ -148,9 +128,8 @@ func promptForArtistSelection(artists []spotify.FullArtist) *spotify.FullArtist
 		return &artists[pick-1]
 	}
 }
-func byArtist(glog logger.Logger, artist spotify.SimpleArtist, name string, length int) (*spotify.FullPlaylist, error) {
-	client := auth.SetupClient()
-	alltracks, err := util.GetAllTracksByArtist(client, artist.ID)
+func byArtist(glog *logger.Logger, client Client, artist spotify.SimpleArtist, name string, length int, types spotify.AlbumType) (*spotify.FullPlaylist, error) {
+	alltracks, err := util.GetAllTracksByArtist(client, artist.ID, types)
 	if err != nil {
 		return nil, fmt.Errorf("could not get tracks from artist with ID %s: %s", artist.ID, err)
 	}
@@ -160,13 +139,32 @@ func byArtist(glog logger.Logger, artist spotify.SimpleArtist, name string, leng
 		return nil, fmt.Errorf("didn't find any tracks for artist with ID %s", artist.ID)
 	}
 
+	playlistName := processName(name, &artist, nil)
+	return createPlaylist(glog, client, playlistName, tracks)
+}
+
+func ByArtistID(glog *logger.Logger, client Client, artistID spotify.ID, name string, length int, types spotify.AlbumType) (*spotify.FullPlaylist, error) {
+	defer glog.Enter("mixtapeByArtistID")()
+
+	artist, err := client.GetArtist(artistID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't look up artist with ID %s: %s", artistID, err)
+	}
+
+	return byArtist(glog, client, artist.SimpleArtist, name, length, types)
+}
+
+// playlistChunkSize is the most tracks spotify will accept in a single
+// add-tracks-to-playlist request.
+const playlistChunkSize = 100
+
+func createPlaylist(glog *logger.Logger, client Client, name string, tracks []spotify.SimpleTrack) (*spotify.FullPlaylist, error) {
 	user, err := client.CurrentUser()
 	if err != nil {
 		return nil, fmt.Errorf("couldn't access current user: %s", err)
 	}
 
-	playlistName := processName(name, &artist, nil)
-	playlist, err := client.CreatePlaylistForUser(user.ID, playlistName, true)
+	playlist, err := client.CreatePlaylistForUser(user.ID, name, true)
 	if err != nil {
 		return nil, fmt.Errorf("couldn't create playlist for user %s: %s", user.ID, err)
 	}
@@ -175,31 +173,139 @@ func byArtist(glog logger.Logger, artist spotify.SimpleArtist, name string, leng
 		glog.Verbose("adding %s", color.CyanString(util.SongAttributionFromSimpleTrack(&track)))
 	}
 
-	_, err = client.AddTracksToPlaylist(user.ID, playlist.ID, util.TracksToIDs(tracks)...)
-	if err != nil {
-		return nil, fmt.Errorf("couldn't add tracks to playlist %s for user %s: %s",
-			color.BlueString(playlist.Name),
-			color.GreenString(user.ID),
-			err,
-		)
+	ids := util.TracksToIDs(tracks)
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > playlistChunkSize {
+			n = playlistChunkSize
+		}
+		_, err = client.AddTracksToPlaylist(user.ID, playlist.ID, ids[:n]...)
+		if err != nil {
+			// TODO: don't use color formatting here, use structured errors
+			return nil, fmt.Errorf("couldn't add tracks to playlist %s for user %s: %s",
+				color.BlueString(playlist.Name),
+				color.GreenString(user.ID),
+				err,
+			)
+		}
+		ids = ids[n:]
 	}
 	return playlist, nil
 }
 
-func ByCurrentArtist(glog logger.Logger, name string, length int) (*spotify.FullPlaylist, error) {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient(), glog)
-	artist := track.Artists[0]
-	return byArtist(glog, artist, name, length)
+// TrackMode decides which of an artist's tracks end up on a playlist
+// made from a list of artists.
+type TrackMode string
+
+const (
+	// TracksLatest uses the latest album plus any singles released
+	// after it
+	TracksLatest TrackMode = "latest"
+	// TracksRandom uses a random selection of the artist's tracks
+	TracksRandom TrackMode = "random"
+	// TracksAll uses every track the artist has released
+	TracksAll TrackMode = "all"
+)
+
+// Valid reports whether m is one of the known track modes.
+func (m TrackMode) Valid() bool {
+	switch m {
+	case TracksLatest, TracksRandom, TracksAll:
+		return true
+	}
+	return false
 }
 
-func ByArtistID(glog logger.Logger, artistID spotify.ID, name string, length int) (*spotify.FullPlaylist, error) {
-	defer glog.Enter("mixtapeByArtistID")()
-	client := auth.SetupClient()
+// ByArtistNames creates a single playlist out of tracks from each of
+// the named artists, e.g. everyone on the line-up for a show. Artists
+// that can't be found on spotify are logged and skipped. length is the
+// number of tracks per artist when using TracksRandom.
+func ByArtistNames(glog *logger.Logger, client Client, artists []string, name string, mode TrackMode, length int) (*spotify.FullPlaylist, error) {
+	defer glog.Enter("mix.ByArtistNames")()
+
+	var alltracks []spotify.SimpleTrack
+	for _, artist := range artists {
+		id := util.FindArtistID(client, artist)
+		if id == nil {
+			glog.Log("couldn't find an artist result for %s", color.RedString(artist))
+			continue
+		}
 
-	artist, err := client.GetArtist(artistID)
-	if err != nil {
-		glog.Fatal("couldn't look up artist with ID %s: %s", artistID, err)
+		tracks, err := tracksByMode(client, *id, mode, length)
+		if err != nil {
+			glog.Log("couldn't get tracks for %s: %s", color.RedString(artist), err)
+			continue
+		}
+		glog.Verbose("found %d tracks for %s", len(tracks), color.BlueString(artist))
+		alltracks = append(alltracks, tracks...)
+	}
+
+	if len(alltracks) == 0 {
+		return nil, fmt.Errorf("didn't find any tracks for %s", strings.Join(artists, ", "))
 	}
+	return createPlaylist(glog, client, name, alltracks)
+}
 
-	return byArtist(glog, artist.SimpleArtist, name, length)
+func tracksByMode(client util.Catalog, artistID spotify.ID, mode TrackMode, length int) ([]spotify.SimpleTrack, error) {
+	switch mode {
+	case TracksRandom:
+		alltracks, err := util.GetAllTracksByArtist(client, artistID, util.DefaultAlbumTypes)
+		if err != nil {
+			return nil, err
+		}
+		return util.RandomTracks(alltracks, length), nil
+	case TracksAll:
+		return util.GetAllTracksByArtist(client, artistID, util.DefaultAlbumTypes)
+	case TracksLatest:
+		albums, err := util.GetAllAlbumsByArtist(client, artistID, util.DefaultAlbumTypes)
+		if err != nil {
+			return nil, err
+		}
+		latest := latestReleases(albums)
+		tracklists := make([][]spotify.SimpleTrack, len(latest))
+		err = fetch.Map(context.Background(), len(latest), fetch.DefaultWorkers, func(ctx context.Context, i int) (err error) {
+			ctx, done := glog.EnterContext(logger.WithFields(ctx, "album", latest[i].ID), "util.GetAlbumTracks")
+			defer done()
+			if tracklists[i], err = util.GetAlbumTracks(client, latest[i].ID); err != nil {
+				glog.Context(ctx).Debug("error getting tracks: %s", err)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		var tracks []spotify.SimpleTrack
+		for _, list := range tracklists {
+			tracks = append(tracks, list...)
+		}
+		return tracks, nil
+	}
+	return nil, fmt.Errorf("unknown track mode %q", mode)
+}
+
+// latestReleases returns the most recent album along with every single
+// released after it, oldest first so the playlist plays in order. If
+// the artist has no albums, all of the singles are returned.
+func latestReleases(albums []spotify.SimpleAlbum) []spotify.SimpleAlbum {
+	sorted := make([]spotify.SimpleAlbum, len(albums))
+	copy(sorted, albums)
+
+	// release dates are YYYY, YYYY-MM or YYYY-MM-DD so they sort fine
+	// as strings
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].ReleaseDate > sorted[j].ReleaseDate
+	})
+
+	var results []spotify.SimpleAlbum
+	for _, album := range sorted {
+		results = append(results, album)
+		if album.AlbumType == "album" {
+			break
+		}
+	}
+
+	for i, j := 0, len(results)-1; i < j; i, j = i+1, j-1 {
+		results[i], results[j] = results[j], results[i]
+	}
+	return results
 }
@@ -0,0 +1,158 @@
+package mix
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/brianloveswords/spotify/logger"
+	"github.com/brianloveswords/spotify/spotifytest"
+	"github.com/brianloveswords/spotify/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify"
+)
+
+func TestLatestReleases(t *testing.T) {
+	albums := []spotify.SimpleAlbum{
+		{Name: "old single", AlbumType: "single", ReleaseDate: "2010-01-01"},
+		{Name: "latest album", AlbumType: "album", ReleaseDate: "2016-05-01"},
+		{Name: "newer single", AlbumType: "single", ReleaseDate: "2017-02-10"},
+		{Name: "older album", AlbumType: "album", ReleaseDate: "2012"},
+		{Name: "newest single", AlbumType: "single", ReleaseDate: "2018-06"},
+	}
+
+	var names []string
+	for _, album := range latestReleases(albums) {
+		names = append(names, album.Name)
+	}
+	assert.Equal(t, []string{"latest album", "newer single", "newest single"}, names)
+
+	singles := albums[:1]
+	assert.Equal(t, singles, latestReleases(singles))
+}
+
+func TestTrackModeValid(t *testing.T) {
+	assert.True(t, TracksLatest.Valid())
+	assert.True(t, TrackMode("all").Valid())
+	assert.False(t, TrackMode("everything").Valid())
+}
+
+// fakeClient answers just enough of Client to make a playlist. Anything
+// else panics on the nil embedded interface.
+type fakeClient struct {
+	Client
+	tracks  map[spotify.ID]*spotify.FullTrack
+	created []string
+	added   [][]spotify.ID
+}
+
+func (f *fakeClient) GetTrack(id spotify.ID) (*spotify.FullTrack, error) {
+	if track, ok := f.tracks[id]; ok {
+		return track, nil
+	}
+	return nil, fmt.Errorf("no track %s", id)
+}
+
+func (f *fakeClient) GetRecommendations(seeds spotify.Seeds, attrs *spotify.TrackAttributes, opt *spotify.Options) (*spotify.Recommendations, error) {
+	recs := &spotify.Recommendations{}
+	for i := 0; i < *opt.Limit; i++ {
+		recs.Tracks = append(recs.Tracks, spotify.SimpleTrack{ID: spotify.ID(fmt.Sprintf("rec%d", i))})
+	}
+	return recs, nil
+}
+
+func (f *fakeClient) CurrentUser() (*spotify.PrivateUser, error) {
+	return &spotify.PrivateUser{User: spotify.User{ID: "tester"}}, nil
+}
+
+func (f *fakeClient) CreatePlaylistForUser(userID, name string, public bool) (*spotify.FullPlaylist, error) {
+	f.created = append(f.created, name)
+	playlist := &spotify.FullPlaylist{}
+	playlist.ID = "playlist"
+	playlist.Name = name
+	return playlist, nil
+}
+
+func (f *fakeClient) AddTracksToPlaylist(userID string, playlistID spotify.ID, ids ...spotify.ID) (string, error) {
+	f.added = append(f.added, ids)
+	return "snapshot", nil
+}
+
+func TestByTrackID(t *testing.T) {
+	seed := &spotify.FullTrack{}
+	seed.ID = "seed"
+	seed.Name = "Wild Blue"
+	seed.Artists = []spotify.SimpleArtist{{Name: "Gleemer"}}
+	client := &fakeClient{tracks: map[spotify.ID]*spotify.FullTrack{"seed": seed}}
+
+	playlist, err := ByTrackID(glog, client, "seed", "{mix} :ARTIST: - :TRACK:", 250)
+	assert.NoError(t, err)
+	assert.Equal(t, "{mix} Gleemer - Wild Blue", playlist.Name)
+	assert.Equal(t, []string{"{mix} Gleemer - Wild Blue"}, client.created)
+
+	// spotify takes at most 100 tracks per request
+	assert.Len(t, client.added, 3)
+	assert.Len(t, client.added[0], 100)
+	assert.Len(t, client.added[1], 100)
+	assert.Len(t, client.added[2], 50)
+	assert.Equal(t, spotify.ID("rec249"), client.added[2][49])
+
+	_, err = ByTrackID(glog, client, "missing", "", 10)
+	assert.Error(t, err)
+}
+
+func TestByTrackIDAgainstFakeAPI(t *testing.T) {
+	client, server := spotifytest.NewClient(spotifytest.DefaultFixtures())
+	defer server.Close()
+
+	playlist, err := ByTrackID(glog, client, "anymore2", ":ARTIST: - :TRACK: mix", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "Gleemer - Down mix", playlist.Name)
+
+	playlists := server.Playlists()
+	assert.Len(t, playlists, 1)
+	assert.Equal(t, playlist.ID, playlists[0].ID)
+	assert.NotEmpty(t, playlists[0].TrackIDs)
+	assert.True(t, len(playlists[0].TrackIDs) <= 5)
+
+	_, err = ByTrackID(glog, client, "nope", "", 5)
+	assert.Error(t, err)
+}
+
+// searchClient finds the artists it's given, and fails to search or
+// look up anything else.
+type searchClient struct {
+	fakeClient
+	artists []spotify.FullArtist
+}
+
+func (s *searchClient) Search(query string, t spotify.SearchType) (*spotify.SearchResult, error) {
+	if query == "error" {
+		return nil, fmt.Errorf("search failed")
+	}
+	return &spotify.SearchResult{Artists: &spotify.FullArtistPage{Artists: s.artists}}, nil
+}
+
+func (s *searchClient) GetArtist(id spotify.ID) (*spotify.FullArtist, error) {
+	return nil, fmt.Errorf("no artist %s", id)
+}
+
+func TestByArtistErrors(t *testing.T) {
+	silent := logger.New()
+	silent.Level = logger.LevelSilent
+
+	client := &searchClient{}
+	_, err := ByArtist(&silent, client, "error", "", 5, util.DefaultAlbumTypes)
+	assert.Error(t, err)
+
+	_, err = ByArtist(&silent, client, "Gleemer", "", 5, util.DefaultAlbumTypes)
+	assert.EqualError(t, err, "could not find any matches for Gleemer")
+
+	client.artists = []spotify.FullArtist{{}, {}}
+	client.artists[0].Name = "Gleemers"
+	client.artists[1].Name = "The Gleemer"
+	_, err = ByArtist(&silent, client, "Gleemer", "", 5, util.DefaultAlbumTypes)
+	assert.EqualError(t, err, "could not find an exact match for Gleemer")
+
+	_, err = ByArtistID(&silent, client, "gone", "", 5, util.DefaultAlbumTypes)
+	assert.Error(t, err)
+}
@@ -0,0 +1,193 @@
+// Package output writes what a command found in the format asked for:
+// text for people, or JSON, TSV or a Go template for scripts.
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// Format is how records are written.
+type Format int
+
+const (
+	// Text is whatever the command normally prints.
+	Text Format = iota
+	// JSON is one object per record, with the fields in order.
+	JSON
+	// TSV is the field values of each record on one line, separated by
+	// tabs, in the order the command documents.
+	TSV
+	// Template runs a text/template on each record, see New.
+	Template
+)
+
+// ParseFormat parses "text", "json" or "tsv".
+func ParseFormat(s string) (Format, error) {
+	switch s {
+	case "", "text":
+		return Text, nil
+	case "json":
+		return JSON, nil
+	case "tsv":
+		return TSV, nil
+	}
+	return Text, fmt.Errorf("unknown output %q, expected text, json or tsv", s)
+}
+
+// Field is one named value in a Record.
+type Field struct {
+	Name  string
+	Value interface{}
+}
+
+// Record is what a command found, in the order it should be shown.
+type Record []Field
+
+// Fields makes a record from alternating names and values.
+func Fields(kv ...interface{}) Record {
+	r := make(Record, 0, len(kv)/2)
+	for i := 0; i+1 < len(kv); i += 2 {
+		r = append(r, Field{fmt.Sprint(kv[i]), kv[i+1]})
+	}
+	return r
+}
+
+// Names returns the names of the fields, in order.
+func (r Record) Names() []string {
+	names := make([]string, len(r))
+	for i, f := range r {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// Get returns the value of the field name.
+func (r Record) Get(name string) (interface{}, bool) {
+	for _, f := range r {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Only returns the fields named, in the order named. It's an error to
+// name a field the record doesn't have.
+func (r Record) Only(names ...string) (Record, error) {
+	only := make(Record, 0, len(names))
+	for _, name := range names {
+		v, ok := r.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("no field %q, expected one of %s", name, strings.Join(r.Names(), ", "))
+		}
+		only = append(only, Field{name, v})
+	}
+	return only, nil
+}
+
+// Map returns the record as a map, which is what templates see.
+func (r Record) Map() map[string]interface{} {
+	m := make(map[string]interface{}, len(r))
+	for _, f := range r {
+		m[f.Name] = f.Value
+	}
+	return m
+}
+
+// Writer writes records in one format.
+type Writer struct {
+	w        io.Writer
+	format   Format
+	template *template.Template
+}
+
+// New returns a writer for format. If tmpl isn't empty it's a
+// text/template that's given each record as a map of its fields, like
+// "{{.artist}} - {{.track}}", and format is ignored.
+func New(w io.Writer, format Format, tmpl string) (*Writer, error) {
+	out := &Writer{w: w, format: format}
+	if tmpl != "" {
+		t, err := template.New("format").Option("missingkey=error").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse --format: %s", err)
+		}
+		out.format = Template
+		out.template = t
+	}
+	return out, nil
+}
+
+// IsText reports whether the writer writes what commands normally
+// print, so they can skip building anything else.
+func (w *Writer) IsText() bool {
+	return w.format == Text
+}
+
+// Write writes r, or text when the format is Text.
+func (w *Writer) Write(r Record, text string) error {
+	var buf bytes.Buffer
+	switch w.format {
+	case Text:
+		buf.WriteString(text)
+	case JSON:
+		if err := writeJSON(&buf, r); err != nil {
+			return err
+		}
+	case TSV:
+		values := make([]string, len(r))
+		for i, f := range r {
+			values[i] = tsvValue(f.Value)
+		}
+		buf.WriteString(strings.Join(values, "\t"))
+	case Template:
+		if err := w.template.Execute(&buf, r.Map()); err != nil {
+			return fmt.Errorf("couldn't run --format: %s", err)
+		}
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteString("\n")
+	}
+	_, err := w.w.Write(buf.Bytes())
+	return err
+}
+
+// writeJSON writes r as an object with its fields in order, which
+// encoding/json won't do for a map.
+func writeJSON(buf *bytes.Buffer, r Record) error {
+	buf.WriteString("{")
+	for i, f := range r {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		k, _ := json.Marshal(f.Name)
+		v, err := json.Marshal(f.Value)
+		if err != nil {
+			return fmt.Errorf("couldn't write %s as JSON: %s", f.Name, err)
+		}
+		buf.Write(k)
+		buf.WriteString(":")
+		buf.Write(v)
+	}
+	buf.WriteString("}")
+	return nil
+}
+
+// tsvValue formats v for a TSV column. Lists are joined with commas, and
+// tabs and newlines become spaces so they can't break the line up.
+func tsvValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case []string:
+		s = strings.Join(v, ",")
+	case nil:
+		s = ""
+	default:
+		s = fmt.Sprint(v)
+	}
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(s)
+}
@@ -0,0 +1,62 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var record = Fields(
+	"track", "Down",
+	"track_id", "anymore2",
+	"artists", []string{"Gleemer", "Someone\tElse"},
+	"duration_ms", 215000,
+	"is_playing", true,
+)
+
+func write(t *testing.T, format Format, tmpl string, r Record) string {
+	var buf bytes.Buffer
+	w, err := New(&buf, format, tmpl)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write(r, "current track: Down"))
+	return buf.String()
+}
+
+func TestFormats(t *testing.T) {
+	assert.Equal(t, "current track: Down\n", write(t, Text, "", record))
+	assert.Equal(t,
+		`{"track":"Down","track_id":"anymore2","artists":["Gleemer","Someone\tElse"],"duration_ms":215000,"is_playing":true}`+"\n",
+		write(t, JSON, "", record))
+	assert.Equal(t, "Down\tanymore2\tGleemer,Someone Else\t215000\ttrue\n", write(t, TSV, "", record))
+	assert.Equal(t, "Down (215000ms)\n", write(t, JSON, "{{.track}} ({{.duration_ms}}ms)", record))
+}
+
+func TestTemplateErrors(t *testing.T) {
+	_, err := New(&bytes.Buffer{}, Text, "{{.track")
+	assert.Error(t, err)
+
+	w, err := New(&bytes.Buffer{}, Text, "{{.nope}}")
+	assert.NoError(t, err)
+	assert.Error(t, w.Write(record, ""))
+}
+
+func TestOnly(t *testing.T) {
+	only, err := record.Only("track_id", "track")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"track_id", "track"}, only.Names())
+	assert.Equal(t, "anymore2\tDown\n", write(t, TSV, "", only))
+
+	_, err = record.Only("album")
+	assert.Error(t, err)
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]Format{"": Text, "text": Text, "json": JSON, "tsv": TSV} {
+		f, err := ParseFormat(in)
+		assert.NoError(t, err)
+		assert.Equal(t, want, f)
+	}
+	_, err := ParseFormat("yaml")
+	assert.Error(t, err)
+}
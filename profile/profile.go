@@ -0,0 +1,66 @@
+// Package profile keeps the token, cache and config of each spotify
+// account used on a machine apart.
+package profile
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/brianloveswords/spotify/logger"
+	"github.com/brianloveswords/spotify/xdg"
+)
+
+// Env picks the profile when there's no --profile.
+const Env = "SPOTIFY_PROFILE"
+
+// Default is the profile used when none is picked. It lives directly in
+// the app directories, so everything from before there were profiles
+// still belongs to it.
+const Default = "default"
+
+// dirName is the directory, inside each of the app directories, that
+// the other profiles live in.
+const dirName = "profiles"
+
+var glog = logger.DefaultLogger
+
+var root = xdg.NewApp("spotify-cli")
+
+var validName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// App returns the directories for the profile name. They aren't created
+// until something is saved in them, so a mistyped name doesn't leave a
+// profile behind. An empty name is the default profile.
+func App(name string) (*xdg.App, error) {
+	defer glog.Enter("profile.App")()
+
+	if name == "" || name == Default {
+		return root, nil
+	}
+	if !validName.MatchString(name) {
+		return nil, fmt.Errorf("bad profile name %q, use letters, numbers, '-', '_' and '.'", name)
+	}
+	return root.Sub(dirName + "/" + name), nil
+}
+
+// List returns the names of the default profile and every profile that
+// has saved something in its data directory, like a login, in order.
+func List() ([]string, error) {
+	defer glog.Enter("profile.List")()
+
+	names := []string{Default}
+	infos, err := root.DataReadDir(dirName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return names, nil
+		}
+		return nil, fmt.Errorf("couldn't list profiles: %s", err)
+	}
+	for _, info := range infos {
+		if info.IsDir() && validName.MatchString(info.Name()) {
+			names = append(names, info.Name())
+		}
+	}
+	return names, nil
+}
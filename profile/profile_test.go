@@ -0,0 +1,71 @@
+package profile
+
+import (
+	"testing"
+
+	"github.com/brianloveswords/spotify/xdg"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+)
+
+func useMemFs() {
+	root = &xdg.App{Home: "/home/test", App: "test-app", AppFs: afero.NewMemMapFs()}
+	root.MakeDirs()
+}
+
+func TestDefaultIsRoot(t *testing.T) {
+	useMemFs()
+	for _, name := range []string{"", Default} {
+		app, err := App(name)
+		assert.NoError(t, err)
+		assert.Equal(t, root, app)
+	}
+}
+
+func TestProfilesAreSeparate(t *testing.T) {
+	useMemFs()
+	alice, err := App("alice")
+	assert.NoError(t, err)
+	bob, err := App("bob")
+	assert.NoError(t, err)
+
+	f, err := alice.DataCreate("token")
+	assert.NoError(t, err)
+	f.Close()
+
+	_, err = bob.DataOpen("token")
+	assert.Error(t, err)
+	_, err = root.DataOpen("token")
+	assert.Error(t, err)
+	_, err = alice.DataOpen("token")
+	assert.NoError(t, err)
+}
+
+func TestBadNames(t *testing.T) {
+	useMemFs()
+	for _, name := range []string{"..", "../x", "a/b", ".hidden", "-flag", "with space"} {
+		_, err := App(name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestList(t *testing.T) {
+	useMemFs()
+	names, err := List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{Default}, names)
+
+	// profiles only show up once something's saved in them
+	for _, name := range []string{"work", "home", "typo"} {
+		app, err := App(name)
+		assert.NoError(t, err)
+		if name != "typo" {
+			f, err := app.DataCreate("token")
+			assert.NoError(t, err)
+			f.Close()
+		}
+	}
+	names, err = List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{Default, "home", "work"}, names)
+}
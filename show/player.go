@@ -0,0 +1,130 @@
+package show
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/zmb3/spotify"
+)
+
+// apiURL is where player requests go. The spotify client we use predates
+// podcasts and can't ask for episodes, so the player is read directly.
+// auth's clients send anything for spotify's API to SPOTIFY_API_URL when
+// it's set, so this doesn't need to change for the fake server.
+var apiURL = "https://api.spotify.com/v1/"
+
+// Client sends requests to spotify's API, already authorized, like the
+// one from auth.SetupHTTPClient.
+type Client interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// player is what me/player and me/player/currently-playing return. Item
+// is a track or an episode depending on Type, and null for ads.
+type player struct {
+	Device *struct {
+		Name   string `json:"name"`
+		Type   string `json:"type"`
+		Volume int    `json:"volume_percent"`
+	} `json:"device"`
+	Context *struct {
+		Type string      `json:"type"`
+		URI  spotify.URI `json:"uri"`
+	} `json:"context"`
+	Progress int             `json:"progress_ms"`
+	Playing  bool            `json:"is_playing"`
+	Type     string          `json:"currently_playing_type"`
+	Item     json.RawMessage `json:"item"`
+}
+
+type episode struct {
+	Name        string      `json:"name"`
+	ID          spotify.ID  `json:"id"`
+	URI         spotify.URI `json:"uri"`
+	Duration    int         `json:"duration_ms"`
+	Explicit    bool        `json:"explicit"`
+	ReleaseDate string      `json:"release_date"`
+	Show        struct {
+		Name      string      `json:"name"`
+		ID        spotify.ID  `json:"id"`
+		URI       spotify.URI `json:"uri"`
+		Publisher string      `json:"publisher"`
+	} `json:"show"`
+}
+
+// statusError is a response spotify didn't mean as a success.
+type statusError struct {
+	status  int
+	message string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("spotify said %d: %s", e.status, e.message)
+}
+
+// getPlayer fetches path, which is me/player or one of its children,
+// asking for episodes as well as tracks. It returns nil when spotify
+// says nothing is playing.
+func getPlayer(client Client, path string) (*player, error) {
+	q := url.Values{"additional_types": {"track,episode"}}
+	resp, err := do(client, "GET", path+"?"+q.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	var p player
+	if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+		return nil, fmt.Errorf("couldn't decode %s: %s", path, err)
+	}
+	return &p, nil
+}
+
+// SaveEpisode adds the episode id to the user's saved episodes, which
+// is what fav does for podcasts.
+func SaveEpisode(client Client, id spotify.ID) error {
+	defer glog.Enter("show.SaveEpisode")()
+
+	q := url.Values{"ids": {string(id)}}
+	resp, err := do(client, "PUT", "me/episodes?"+q.Encode())
+	if err != nil {
+		return fmt.Errorf("couldn't save episode: %s", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a request for path and turns error statuses into a
+// statusError, closing the body.
+func do(client Client, method, path string) (*http.Response, error) {
+	req, err := http.NewRequest(method, apiURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		var body struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		message := strings.TrimSpace(string(b))
+		if json.Unmarshal(b, &body) == nil && body.Error.Message != "" {
+			message = body.Error.Message
+		}
+		return nil, &statusError{resp.StatusCode, message}
+	}
+	return resp, nil
+}
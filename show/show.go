@@ -1,40 +1,366 @@
+// Package show describes what spotify is playing, for the info
+// commands.
 package show
 
 import (
-	"github.com/brianloveswords/spotify/auth"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/brianloveswords/spotify/logger"
+	"github.com/brianloveswords/spotify/output"
 	"github.com/brianloveswords/spotify/util"
-	"github.com/fatih/color"
+	"github.com/zmb3/spotify"
 )
 
 var glog = logger.DefaultLogger
 
-func Show() {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient())
-	name := util.SongAttributionFromTrack(track)
-	glog.Log("currently playing %s", color.CyanString(name))
+// Kind is what sort of thing the player is playing.
+type Kind string
+
+// The kinds spotify reports, plus KindIdle for when the player has
+// nothing at all.
+const (
+	KindIdle    Kind = "idle"
+	KindTrack   Kind = "track"
+	KindEpisode Kind = "episode"
+	KindAd      Kind = "ad"
+	KindUnknown Kind = "unknown"
+)
+
+// KindError is returned when what's playing isn't something a command
+// can work with, like asking for the album during a podcast.
+type KindError struct {
+	Kind Kind
+	// Want is what was needed, when it was one particular kind.
+	Want Kind
+}
+
+func (e *KindError) Error() string {
+	switch e.Kind {
+	case KindIdle:
+		return "nothing is playing"
+	case KindAd:
+		return "an ad is playing"
+	case KindUnknown:
+		return "spotify doesn't know what's playing"
+	}
+	if e.Want == "" {
+		return fmt.Sprintf("can't do that while a %s is playing", e.Kind.noun())
+	}
+	return fmt.Sprintf("a %s is playing, not a %s", e.Kind.noun(), e.Want.noun())
+}
+
+func (k Kind) noun() string {
+	if k == KindEpisode {
+		return "podcast episode"
+	}
+	return string(k)
+}
+
+// Item is anything spotify has a name, ID and URI for.
+type Item struct {
+	Name string
+	ID   spotify.ID
+	URI  spotify.URI
+}
+
+// Track is the track that's playing.
+type Track struct {
+	Item
+	Duration    time.Duration
+	Popularity  int
+	Explicit    bool
+	TrackNumber int
+}
+
+// Album is the album the track is from.
+type Album struct {
+	Item
+	ReleaseDate string
+}
+
+// Episode is the podcast episode that's playing.
+type Episode struct {
+	Item
+	Show        Item
+	Publisher   string
+	Duration    time.Duration
+	Explicit    bool
+	ReleaseDate string
+}
+
+// Device is where the track is playing.
+type Device struct {
+	Name   string
+	Type   string
+	Volume int
+}
+
+// Context is what the track is being played from, like a playlist or
+// an album.
+type Context struct {
+	Type string
+	URI  spotify.URI
+}
+
+// NowPlaying is what the player is doing. Which of Track, Artists and
+// Album or Episode are filled in depends on Kind; during an ad neither
+// are.
+type NowPlaying struct {
+	Kind     Kind
+	Track    Track
+	Artists  []Item
+	Album    Album
+	Episode  Episode
+	Progress time.Duration
+	Playing  bool
+	// Device is nil if it isn't known, which it isn't when the token
+	// can't read the player state.
+	Device *Device
+	// Context is nil when the track isn't played from anything, like
+	// when it was picked from search results.
+	Context *Context
 }
-func Artist() {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient())
-	glog.Log(track.Artists[0].Name)
+
+// Load asks spotify what's playing. The full player state says where,
+// but needs a scope older tokens don't have, so without it the device
+// is left out. When nothing is playing the Kind is KindIdle.
+func Load(client Client) (*NowPlaying, error) {
+	defer glog.Enter("show.Load")()
+
+	p, err := getPlayer(client, "me/player")
+	if err != nil {
+		glog.Debug("couldn't get player state, trying currently playing: %s", err)
+		p, err = getPlayer(client, "me/player/currently-playing")
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get currently playing: %s", err)
+		}
+		if p != nil {
+			p.Device = nil
+		}
+	}
+	return fromPlayer(p)
 }
-func ArtistID() {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient())
-	glog.Log("%s", track.Artists[0].ID)
+
+func fromPlayer(p *player) (*NowPlaying, error) {
+	if p == nil {
+		return &NowPlaying{Kind: KindIdle}, nil
+	}
+	now := &NowPlaying{
+		Kind:     Kind(p.Type),
+		Progress: time.Duration(p.Progress) * time.Millisecond,
+		Playing:  p.Playing,
+	}
+	if p.Device != nil {
+		now.Device = &Device{Name: p.Device.Name, Type: p.Device.Type, Volume: p.Device.Volume}
+	}
+	if p.Context != nil && p.Context.URI != "" {
+		now.Context = &Context{Type: p.Context.Type, URI: p.Context.URI}
+	}
+
+	// older responses don't say, but can only be tracks
+	if now.Kind == "" {
+		now.Kind = KindTrack
+	}
+	hasItem := len(p.Item) > 0 && string(p.Item) != "null"
+	switch {
+	case now.Kind == KindTrack && hasItem:
+		var track spotify.FullTrack
+		if err := json.Unmarshal(p.Item, &track); err != nil {
+			return nil, fmt.Errorf("couldn't decode track: %s", err)
+		}
+		now.setTrack(&track)
+	case now.Kind == KindEpisode && hasItem:
+		var ep episode
+		if err := json.Unmarshal(p.Item, &ep); err != nil {
+			return nil, fmt.Errorf("couldn't decode episode: %s", err)
+		}
+		now.Episode = Episode{
+			Item:        Item{ep.Name, ep.ID, ep.URI},
+			Show:        Item{ep.Show.Name, ep.Show.ID, ep.Show.URI},
+			Publisher:   ep.Show.Publisher,
+			Duration:    time.Duration(ep.Duration) * time.Millisecond,
+			Explicit:    ep.Explicit,
+			ReleaseDate: ep.ReleaseDate,
+		}
+	case now.Kind == KindAd:
+	default:
+		// a track or episode spotify wouldn't tell us about
+		glog.Debug("no item for %s", now.Kind)
+		now.Kind = KindUnknown
+	}
+	return now, nil
 }
-func ArtistURI() {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient())
-	glog.Log("%s", track.Artists[0].URI)
+
+func (n *NowPlaying) setTrack(track *spotify.FullTrack) {
+	n.Track = Track{
+		Item:        Item{track.Name, track.ID, track.URI},
+		Duration:    time.Duration(track.Duration) * time.Millisecond,
+		Popularity:  track.Popularity,
+		Explicit:    track.Explicit,
+		TrackNumber: track.TrackNumber,
+	}
+	n.Album = Album{
+		Item:        Item{track.Album.Name, track.Album.ID, track.Album.URI},
+		ReleaseDate: track.Album.ReleaseDate,
+	}
+	for _, a := range track.Artists {
+		n.Artists = append(n.Artists, Item{a.Name, a.ID, a.URI})
+	}
 }
-func Track() {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient())
-	glog.Log("%s", track.Name)
+
+// Require returns a KindError unless one of kinds is playing.
+func (n *NowPlaying) Require(kinds ...Kind) error {
+	for _, k := range kinds {
+		if n.Kind == k {
+			return nil
+		}
+	}
+	err := &KindError{Kind: n.Kind}
+	if len(kinds) == 1 {
+		err.Want = kinds[0]
+	}
+	return err
 }
-func TrackID() {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient())
-	glog.Log("%s", track.ID)
+
+// Artist is the first of the track's artists, which is the one it's
+// usually filed under.
+func (n *NowPlaying) Artist() Item {
+	if len(n.Artists) == 0 {
+		return Item{}
+	}
+	return n.Artists[0]
 }
-func TrackURI() {
-	track := util.MustGetCurrentlyPlaying(auth.SetupClient())
-	glog.Log("%s", track.URI)
+
+// String is "Artist, Other Artist - Track" or "Show - Episode", or
+// says what's playing when it's neither.
+func (n *NowPlaying) String() string {
+	switch n.Kind {
+	case KindTrack:
+		names := make([]string, len(n.Artists))
+		for i, a := range n.Artists {
+			names[i] = a.Name
+		}
+		return fmt.Sprintf("%s - %s", strings.Join(names, ", "), n.Track.Name)
+	case KindEpisode:
+		return fmt.Sprintf("%s - %s", n.Episode.Show.Name, n.Episode.Name)
+	}
+	return (&KindError{Kind: n.Kind}).Error()
+}
+
+// Fields are the names of the fields in a record, in order.
+var Fields = (&NowPlaying{}).Record().Names()
+
+// fieldKinds are the kinds each field means something for. Fields that
+// aren't here are about the player, so always do.
+var fieldKinds = map[string][]Kind{}
+
+func init() {
+	for _, name := range []string{
+		"track", "track_id", "track_uri",
+		"artist", "artist_id", "artist_uri", "artists", "artist_ids",
+		"album", "album_id", "album_uri", "popularity",
+	} {
+		fieldKinds[name] = []Kind{KindTrack}
+	}
+	for _, name := range []string{
+		"episode", "episode_id", "episode_uri",
+		"show", "show_id", "show_uri", "publisher",
+	} {
+		fieldKinds[name] = []Kind{KindEpisode}
+	}
+	for _, name := range []string{"release_date", "duration_ms", "duration", "explicit"} {
+		fieldKinds[name] = []Kind{KindTrack, KindEpisode}
+	}
+}
+
+// Record is everything about what's playing as named fields, for
+// --output and --format and for picking fields out by name. Fields that
+// don't apply to what's playing are empty.
+func (n *NowPlaying) Record() output.Record {
+	var names, ids []string
+	for _, a := range n.Artists {
+		names = append(names, a.Name)
+		ids = append(ids, string(a.ID))
+	}
+	var device Device
+	if n.Device != nil {
+		device = *n.Device
+	}
+	var context Context
+	if n.Context != nil {
+		context = *n.Context
+	}
+	artist := n.Artist()
+
+	duration, released, explicit := n.Track.Duration, n.Album.ReleaseDate, n.Track.Explicit
+	if n.Kind == KindEpisode {
+		duration, released, explicit = n.Episode.Duration, n.Episode.ReleaseDate, n.Episode.Explicit
+	}
+
+	return output.Fields(
+		"kind", n.Kind,
+		"track", n.Track.Name,
+		"track_id", n.Track.ID,
+		"track_uri", n.Track.URI,
+		"artist", artist.Name,
+		"artist_id", artist.ID,
+		"artist_uri", artist.URI,
+		"artists", names,
+		"artist_ids", ids,
+		"album", n.Album.Name,
+		"album_id", n.Album.ID,
+		"album_uri", n.Album.URI,
+		"episode", n.Episode.Name,
+		"episode_id", n.Episode.ID,
+		"episode_uri", n.Episode.URI,
+		"show", n.Episode.Show.Name,
+		"show_id", n.Episode.Show.ID,
+		"show_uri", n.Episode.Show.URI,
+		"publisher", n.Episode.Publisher,
+		"release_date", released,
+		"duration_ms", milliseconds(duration),
+		"progress_ms", milliseconds(n.Progress),
+		"duration", util.FormatDuration(duration),
+		"progress", util.FormatDuration(n.Progress),
+		"popularity", n.Track.Popularity,
+		"explicit", explicit,
+		"is_playing", n.Playing,
+		"device", device.Name,
+		"device_type", device.Type,
+		"volume_percent", device.Volume,
+		"context_type", context.Type,
+		"context_uri", context.URI,
+	)
+}
+
+// Select returns the named fields of the record, or all of them if
+// there aren't any names. Naming a field that doesn't apply to what's
+// playing, or anything at all when nothing is, is a KindError.
+func (n *NowPlaying) Select(names ...string) (output.Record, error) {
+	if n.Kind == KindIdle {
+		return nil, &KindError{Kind: KindIdle}
+	}
+	r := n.Record()
+	if len(names) == 0 {
+		return r, nil
+	}
+	r, err := r.Only(names...)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if kinds, ok := fieldKinds[name]; ok {
+			if err := n.Require(kinds...); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return r, nil
+}
+
+func milliseconds(d time.Duration) int {
+	return int(d / time.Millisecond)
 }
@@ -0,0 +1,166 @@
+package show
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify"
+)
+
+const trackJSON = `{
+	"device": {"name": "kitchen", "type": "Speaker", "volume_percent": 60},
+	"context": {"type": "playlist", "uri": "spotify:playlist:mine"},
+	"progress_ms": 65000,
+	"is_playing": true,
+	"currently_playing_type": "track",
+	"item": {
+		"name": "Down", "id": "anymore2", "uri": "spotify:track:anymore2",
+		"duration_ms": 215000, "popularity": 40,
+		"artists": [
+			{"name": "Gleemer", "id": "gleemer", "uri": "spotify:artist:gleemer"},
+			{"name": "Someone Else", "id": "else", "uri": "spotify:artist:else"}
+		],
+		"album": {"name": "Down Through", "id": "through", "uri": "spotify:album:through"}
+	}
+}`
+
+const episodeJSON = `{
+	"progress_ms": 1000,
+	"is_playing": true,
+	"currently_playing_type": "episode",
+	"item": {
+		"name": "Pilot", "id": "pilot", "uri": "spotify:episode:pilot",
+		"duration_ms": 3600000, "release_date": "2019-01-02",
+		"show": {"name": "Talking", "id": "talking", "uri": "spotify:show:talking", "publisher": "Someone"}
+	}
+}`
+
+const adJSON = `{"is_playing": true, "currently_playing_type": "ad", "item": null}`
+
+// serve answers each path with its body, 204 for an empty one, and 403
+// for paths it doesn't have, like a token without the scope to read the
+// player state. The returned function puts things back.
+func serve(t *testing.T, bodies map[string]string) func() {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "track,episode", r.URL.Query().Get("additional_types"))
+		body, ok := bodies[r.URL.Path]
+		switch {
+		case !ok:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": {"status": 403, "message": "Insufficient client scope"}}`))
+		case body == "":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Write([]byte(body))
+		}
+	}))
+	old := apiURL
+	apiURL = s.URL + "/"
+	return func() {
+		apiURL = old
+		s.Close()
+	}
+}
+
+func load(t *testing.T, bodies map[string]string) *NowPlaying {
+	defer serve(t, bodies)()
+	now, err := Load(http.DefaultClient)
+	assert.NoError(t, err)
+	return now
+}
+
+func TestLoadTrack(t *testing.T) {
+	now := load(t, map[string]string{"/me/player": trackJSON})
+	assert.Equal(t, KindTrack, now.Kind)
+	assert.Equal(t, "Gleemer, Someone Else - Down", now.String())
+	assert.Equal(t, "Gleemer", now.Artist().Name)
+	assert.Equal(t, 215*time.Second, now.Track.Duration)
+	assert.Equal(t, &Device{Name: "kitchen", Type: "Speaker", Volume: 60}, now.Device)
+	assert.Equal(t, &Context{Type: "playlist", URI: "spotify:playlist:mine"}, now.Context)
+}
+
+func TestLoadFallsBackWithoutPlayerState(t *testing.T) {
+	now := load(t, map[string]string{"/me/player/currently-playing": trackJSON})
+	assert.Equal(t, "Down", now.Track.Name)
+	assert.Nil(t, now.Device)
+}
+
+func TestLoadEpisode(t *testing.T) {
+	now := load(t, map[string]string{"/me/player": episodeJSON})
+	assert.Equal(t, KindEpisode, now.Kind)
+	assert.Equal(t, "Talking - Pilot", now.String())
+	assert.Equal(t, Item{"Talking", "talking", "spotify:show:talking"}, now.Episode.Show)
+	assert.Equal(t, time.Hour, now.Episode.Duration)
+	assert.Nil(t, now.Context)
+
+	r, err := now.Select("episode_uri", "show", "duration")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{spotify.URI("spotify:episode:pilot"), "Talking", "60:00"},
+		[]interface{}{r[0].Value, r[1].Value, r[2].Value})
+
+	_, err = now.Select("album")
+	assert.Equal(t, &KindError{Kind: KindEpisode, Want: KindTrack}, err)
+	assert.EqualError(t, err, "a podcast episode is playing, not a track")
+}
+
+func TestLoadIdleAndAds(t *testing.T) {
+	now := load(t, map[string]string{"/me/player": ""})
+	assert.Equal(t, KindIdle, now.Kind)
+	_, err := now.Select()
+	assert.EqualError(t, err, "nothing is playing")
+
+	now = load(t, map[string]string{"/me/player": adJSON})
+	assert.Equal(t, KindAd, now.Kind)
+	assert.Equal(t, "an ad is playing", now.String())
+	_, err = now.Select("is_playing")
+	assert.NoError(t, err)
+	_, err = now.Select("duration")
+	assert.Equal(t, &KindError{Kind: KindAd}, err)
+	assert.Equal(t, &KindError{Kind: KindAd}, now.Require(KindTrack, KindEpisode))
+}
+
+func TestLoadError(t *testing.T) {
+	defer serve(t, map[string]string{})()
+	_, err := Load(http.DefaultClient)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Insufficient client scope")
+}
+
+func TestSelect(t *testing.T) {
+	now := load(t, map[string]string{"/me/player": trackJSON})
+
+	all, err := now.Select()
+	assert.NoError(t, err)
+	assert.Equal(t, Fields, all.Names())
+
+	r, err := now.Select("progress", "artists", "context_uri")
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{
+		"1:05",
+		[]string{"Gleemer", "Someone Else"},
+		spotify.URI("spotify:playlist:mine"),
+	}, []interface{}{r[0].Value, r[1].Value, r[2].Value})
+
+	_, err = now.Select("show")
+	assert.EqualError(t, err, "a track is playing, not a podcast episode")
+
+	_, err = now.Select("nope")
+	assert.Error(t, err)
+}
+
+func TestSaveEpisode(t *testing.T) {
+	var got string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery
+	}))
+	defer s.Close()
+	old := apiURL
+	apiURL = s.URL + "/"
+	defer func() { apiURL = old }()
+
+	assert.NoError(t, SaveEpisode(http.DefaultClient, "pilot"))
+	assert.Equal(t, "PUT /me/episodes?ids=pilot", got)
+}
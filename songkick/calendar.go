@@ -0,0 +1,102 @@
+package songkick
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Event is a single upcoming show from an artist's songkick calendar.
+type Event struct {
+	Summary  string
+	Date     time.Time
+	Location string
+	URL      string
+}
+
+// ParseCalendar reads the VEVENTs out of an iCalendar feed. It only
+// understands the handful of properties songkick uses.
+func ParseCalendar(r io.Reader) (events []Event, err error) {
+	var (
+		event *Event
+		lines []string
+	)
+
+	// long lines are folded by starting the continuation with a space
+	// or tab, so unfold everything before looking at properties
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		name, value := splitProperty(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			event = &Event{}
+		case name == "END" && value == "VEVENT":
+			if event == nil {
+				return nil, fmt.Errorf("END:VEVENT without BEGIN")
+			}
+			events = append(events, *event)
+			event = nil
+		case event == nil:
+			continue
+		case name == "SUMMARY":
+			event.Summary = unescapeText(value)
+		case name == "LOCATION":
+			event.Location = unescapeText(value)
+		case name == "URL":
+			event.URL = value
+		case name == "DTSTART":
+			if event.Date, err = parseDate(value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Date.Before(events[j].Date)
+	})
+	return events, nil
+}
+
+// splitProperty turns "DTSTART;VALUE=DATE:20181020" into "DTSTART" and
+// "20181020", dropping any parameters.
+func splitProperty(line string) (name, value string) {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return line, ""
+	}
+	name, value = line[:i], line[i+1:]
+	if j := strings.Index(name, ";"); j >= 0 {
+		name = name[:j]
+	}
+	return strings.ToUpper(name), value
+}
+
+func parseDate(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("couldn't parse date %q", value)
+}
+
+var textUnescaper = strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, "\n", `\N`, "\n", `\\`, `\`)
+
+func unescapeText(s string) string {
+	return textUnescaper.Replace(s)
+}
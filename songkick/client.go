@@ -0,0 +1,111 @@
+package songkick
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client is everything we ask of songkick.
+type Client interface {
+	// SearchArtists returns the artists songkick finds for name,
+	// ranked best match first
+	SearchArtists(name string) ([]Candidate, error)
+	// Lineup returns the artists playing the concert at concertURL
+	Lineup(concertURL string) ([]string, error)
+	// ArtistEvents returns the upcoming events for the artist with the
+	// given songkick ID, sorted by date
+	ArtistEvents(id int) ([]Event, error)
+}
+
+// DefaultBaseURL is where the real songkick lives.
+var DefaultBaseURL = "https://www.songkick.com"
+
+// DefaultClient talks to songkick.com using http.DefaultClient.
+var DefaultClient Client = NewHTTPClient(DefaultBaseURL, http.DefaultClient)
+
+// HTTPClient scrapes songkick pages over HTTP. BaseURL can be pointed at
+// a different host, e.g. a fixture server in tests.
+type HTTPClient struct {
+	BaseURL string
+	HTTP    *http.Client
+}
+
+// NewHTTPClient returns a client that makes requests to baseURL with
+// the given http.Client.
+func NewHTTPClient(baseURL string, client *http.Client) *HTTPClient {
+	return &HTTPClient{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTP:    client,
+	}
+}
+
+func (c *HTTPClient) SearchArtists(name string) ([]Candidate, error) {
+	body, err := c.get(artistSearchURL(c.BaseURL, name))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	candidates, err := ParseSearchPage(body)
+	if err != nil {
+		return nil, err
+	}
+	return Rank(name, candidates), nil
+}
+
+func (c *HTTPClient) Lineup(concertURL string) ([]string, error) {
+	// concert URLs are usually pasted from a browser so they'll point
+	// at songkick.com, only keep the path so BaseURL is respected
+	u, err := url.Parse(concertURL)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.get(c.BaseURL + u.EscapedPath())
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ParseShowPage(body)
+}
+
+func (c *HTTPClient) ArtistEvents(id int) ([]Event, error) {
+	body, err := c.get(artistCalendarURL(c.BaseURL, id))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ParseCalendar(body)
+}
+
+func (c *HTTPClient) get(url string) (io.ReadCloser, error) {
+	resp, err := c.HTTP.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("didn't get 200 looking up %s, got %d", url, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// ArtistSearchURL is the songkick page listing the artists matching
+// name, for when a person needs to pick the right one.
+func ArtistSearchURL(name string) string {
+	return artistSearchURL(DefaultBaseURL, name)
+}
+
+func artistSearchURL(base, name string) string {
+	return fmt.Sprintf("%s/search?utf8=✓&query=%s&type=artists", base, url.QueryEscape(name))
+}
+
+func artistCalendarURL(base string, id int) string {
+	return fmt.Sprintf("%s/artists/%d/calendar.ics", base, id)
+}
+
+// ArtistURL is the songkick page for the artist with the given ID.
+func ArtistURL(id int) string {
+	return fmt.Sprintf("%s/artists/%d", DefaultBaseURL, id)
+}
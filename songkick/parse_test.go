@@ -0,0 +1,11 @@
+package songkick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSongkickIDFromHref(t *testing.T) {
+	assert.Equal(t, 7180534, idFromHref("/artists/7180534-gleemer"))
+}
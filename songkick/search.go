@@ -0,0 +1,140 @@
+package songkick
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Candidate is one of the artists returned by a songkick search.
+type Candidate struct {
+	ID   int
+	Name string
+	// Snippet is the extra context songkick shows under the name,
+	// usually where the artist is from
+	Snippet string
+	OnTour  bool
+	// Score is how closely Name matches what we searched for, from 0
+	// (nothing alike) to 1 (the same once normalized)
+	Score float64
+}
+
+const (
+	// ScoreExact is the score of a name that only differs by case,
+	// punctuation, diacritics, a leading "The" or "&" vs "and"
+	ScoreExact = 1.0
+
+	// a top candidate is accepted without asking when it's at least
+	// this good...
+	minAcceptScore = 0.9
+	// ...and at least this much better than the runner up
+	minAcceptMargin = 0.1
+)
+
+// Rank scores each candidate against name and sorts them best first.
+// Ties keep songkick's order, which is roughly by popularity.
+func Rank(name string, candidates []Candidate) []Candidate {
+	ranked := make([]Candidate, len(candidates))
+	copy(ranked, candidates)
+
+	for i := range ranked {
+		ranked[i].Score = Similarity(name, ranked[i].Name)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+	return ranked
+}
+
+// Best returns the top candidate from a ranked list if it's an
+// unambiguous match: close enough to the name we searched for, and
+// clearly better than anything else. When two candidates normalize to
+// the same name (e.g. two bands called "Gleemer") it gives up.
+func Best(ranked []Candidate) (Candidate, bool) {
+	if len(ranked) == 0 {
+		return Candidate{}, false
+	}
+	top := ranked[0]
+	if top.Score < minAcceptScore {
+		return Candidate{}, false
+	}
+	if len(ranked) > 1 && top.Score-ranked[1].Score < minAcceptMargin {
+		return Candidate{}, false
+	}
+	return top, true
+}
+
+// Similarity compares two artist names, returning 1 when they're the
+// same after normalization and falling off with the edit distance
+// between them otherwise.
+func Similarity(a, b string) float64 {
+	a, b = NormalizeName(a), NormalizeName(b)
+	if a == b {
+		return ScoreExact
+	}
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(longest)
+}
+
+// NormalizeName folds an artist name down to something comparable:
+// lower case, no diacritics or punctuation, "&" spelled "and" and no
+// leading "the", so "The Beyoncé & Friends!" becomes "beyonce and
+// friends".
+func NormalizeName(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(name)) {
+		switch {
+		case unicode.Is(unicode.Mn, r):
+			// combining marks left over from decomposing é into e + ´
+			continue
+		case r == '&':
+			b.WriteString(" and ")
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune(' ')
+		}
+	}
+
+	words := strings.Fields(b.String())
+	if len(words) > 1 && words[0] == "the" {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,59 @@
+package songkick
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeName(t *testing.T) {
+	for in, want := range map[string]string{
+		"Gleemer":                "gleemer",
+		"The Beatles":            "beatles",
+		"the the":                "the",
+		"Beyoncé":                "beyonce",
+		"Sigur Rós":              "sigur ros",
+		"Belle & Sebastian":      "belle and sebastian",
+		"Belle and Sebastian":    "belle and sebastian",
+		"  Godspeed You! Black ": "godspeed you black",
+		"Mötley Crüe":            "motley crue",
+		"The":                    "the",
+	} {
+		assert.Equal(t, want, NormalizeName(in), in)
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	assert.Equal(t, ScoreExact, Similarity("The Beatles", "beatles"))
+	assert.Equal(t, ScoreExact, Similarity("Simon & Garfunkel", "Simon and Garfunkel"))
+	assert.Equal(t, ScoreExact, Similarity("Bjork", "Björk"))
+	assert.True(t, Similarity("Gleemer", "Gleemers") > Similarity("Gleemer", "Glass Animals"))
+	assert.Equal(t, 0.0, Similarity("abc", "xyz"))
+}
+
+func TestRankAndBest(t *testing.T) {
+	candidates := []Candidate{
+		{ID: 1, Name: "Gleemers"},
+		{ID: 2, Name: "Gleemer"},
+		{ID: 3, Name: "Glee Cast"},
+	}
+	ranked := Rank("gleemer", candidates)
+	assert.Equal(t, 2, ranked[0].ID)
+	assert.Equal(t, 1, ranked[1].ID)
+	assert.Equal(t, 3, ranked[2].ID)
+
+	// exact match, but the runner up is too close to call
+	_, ok := Best(Rank("gleemer", []Candidate{{ID: 1, Name: "Gleemer"}, {ID: 2, Name: "The Gleemer"}}))
+	assert.False(t, ok)
+
+	// nothing that looks like what we searched for
+	_, ok = Best(Rank("gleemer", []Candidate{{ID: 1, Name: "Glass Animals"}}))
+	assert.False(t, ok)
+
+	best, ok := Best(Rank("Belle and Sebastian", []Candidate{{ID: 7, Name: "Belle & Sebastian"}}))
+	assert.True(t, ok)
+	assert.Equal(t, 7, best.ID)
+
+	_, ok = Best(nil)
+	assert.False(t, ok)
+}
@@ -1,53 +1,39 @@
-package main
+package songkick
 
 import (
-	"bufio"
 	"fmt"
 	"io"
-	"log"
-	"net/http"
-	"net/url"
-	"os"
 	"path"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"golang.org/x/net/html"
 )
 
-var songkickDataFilename = "artist-songkick.data"
+var reConcertURL = regexp.MustCompile(`^https?://(www\.)?songkick\.com/concerts/\d+`)
 
-func loadSongkickData() (intmap map[string]int) {
-	return loadIntMap(songkickDataFilename)
+// IsConcertURL reports whether u looks like a songkick concert page,
+// e.g. https://www.songkick.com/concerts/33692814-royal-they-at-alphaville
+func IsConcertURL(u string) bool {
+	return reConcertURL.MatchString(u)
 }
-func saveSongkickData(skmap map[string]int) {
-	saveIntMap(songkickDataFilename, skmap)
-}
-
-func artistsFromSongkickShowPage(url string) []string {
-	resp, err := http.Get(url)
-	if err != nil {
-		panic(err)
-	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Fatalf("didn't get 200 lookup up %s, got %d", url, resp.StatusCode)
-	}
-	return parseShowPage(resp.Body)
-}
-
-func parseShowPage(r io.Reader) (artists []string) {
+// ParseShowPage extracts the line-up from the HTML of a concert page.
+func ParseShowPage(r io.Reader) (artists []string, err error) {
 	doc, err := html.Parse(r)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	lineup := getElementByClass(doc, "line-up")
+	if lineup == nil {
+		return nil, fmt.Errorf("couldn't find a line-up on the page")
+	}
 
 	for _, el := range getElementsByTagName(lineup, "span") {
-		artists = append(artists, getFirstTextData(el))
+		artists = append(artists, strings.TrimSpace(getFirstTextData(el)))
 	}
-	return artists
+	return artists, nil
 }
 
 func getFirstTextData(n *html.Node) string {
@@ -110,6 +96,26 @@ func getElementByClass(n *html.Node, class string) *html.Node {
 	return visit(n, class, nil)
 }
 
+// findByClass is like getElementByClass but matches elements that have
+// class as one of several classes, e.g. class="item-state-tag on-tour"
+func findByClass(n *html.Node, class string) (found *html.Node) {
+	forEachNode(n, func(el *html.Node) {
+		if found == nil && hasClass(el, class) {
+			found = el
+		}
+	}, nil)
+	return found
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(lookupAttr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
 func lookupAttr(n *html.Node, attr string) string {
 	for _, a := range n.Attr {
 		if a.Key == attr {
@@ -119,50 +125,45 @@ func lookupAttr(n *html.Node, attr string) string {
 	return ""
 }
 
-func getIDFromSongkickPage(artist string) int {
-	url := songkickArtistURL(artist)
-	resp, err := http.Get(url)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		log.Fatalf("didn't get 200 lookup up %s, got %d", url, resp.StatusCode)
-	}
-	return parseSongkickPage(resp.Body, artist)
-}
-
-func parseSongkickPage(src io.Reader, artist string) int {
-	artist = strings.ToLower(artist)
-
+// ParseSearchPage returns every artist in the HTML of an artist search
+// results page, in the order songkick listed them. The candidates are
+// not scored, see Rank.
+func ParseSearchPage(src io.Reader) (candidates []Candidate, err error) {
 	doc, err := html.Parse(src)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	var artistNodes []*html.Node
 	forEachNode(doc, func(n *html.Node) {
-		if n.Type == html.ElementNode && n.Data == "li" {
-			for _, a := range n.Attr {
-				if a.Key == "class" && a.Val == "artist" {
-					artistNodes = append(artistNodes, n)
-				}
-			}
+		if n.Type == html.ElementNode && n.Data == "li" && hasClass(n, "artist") {
+			artistNodes = append(artistNodes, n)
 		}
 	}, nil)
 
 	for _, artistNode := range artistNodes {
 		link := findArtistLink(artistNode)
-		name := artistNameFromLink(link)
+		if link == nil {
+			continue
+		}
+		id := idFromLink(link)
+		if id == NotFound {
+			continue
+		}
 
-		if strings.ToLower(name) == artist {
-			return idFromLink(link)
+		candidate := Candidate{
+			ID:     id,
+			Name:   strings.TrimSpace(artistNameFromLink(link)),
+			OnTour: findByClass(artistNode, "on-tour") != nil,
+		}
+		if snippet := findByClass(artistNode, "location"); snippet != nil {
+			candidate.Snippet = strings.TrimSpace(getFirstTextData(snippet))
 		}
+		candidates = append(candidates, candidate)
 	}
-
-	return SongkickNotFound
+	return candidates, nil
 }
+
 func artistNameFromLink(n *html.Node) (name string) {
 	forEachNode(n, func(n *html.Node) {
 		if n.Type == html.TextNode {
@@ -178,7 +179,7 @@ func idFromLink(n *html.Node) (id int) {
 			return idFromHref(a.Val)
 		}
 	}
-	return SongkickNotFound
+	return NotFound
 }
 
 func idFromHref(href string) int {
@@ -186,7 +187,7 @@ func idFromHref(href string) int {
 	fields := strings.Split(base, "-")
 	id, err := strconv.Atoi(fields[0])
 	if err != nil {
-		return SongkickNotFound
+		return NotFound
 	}
 	return id
 }
@@ -253,82 +254,7 @@ func forEachNode(n *html.Node, pre, post func(n *html.Node)) {
 	}
 }
 
-var SongkickUnknown = 0
-var SongkickNotFound = -1
-
-var songkickBaseURL = "https://www.songkick.com/search?utf8=✓&query=%s&type=artists"
-
-func songkickArtistURL(name string) string {
-	location := fmt.Sprintf(songkickBaseURL, url.QueryEscape(name))
-	return location
-}
-
-func lookupSongkickIDs(artists []Artist) {
-	skmap := loadSongkickData()
-
-	var notfound []Artist
-	var manual []Artist
-
-	for _, artist := range artists {
-		artist.SongkickID = skmap[artist.Name]
-
-		if artist.SongkickID == SongkickUnknown {
-			notfound = append(notfound, artist)
-		}
-	}
-
-	fmt.Printf("lookup up songkick IDs for %d artists...\n", len(notfound))
-
-	for _, artist := range notfound {
-		artist.SongkickID = skmap[artist.Name]
-
-		if artist.SongkickID != SongkickUnknown {
-			continue
-		}
-
-		// try to look up automatically
-		id := getIDFromSongkickPage(artist.Name)
-		if id == SongkickNotFound {
-			manual = append(manual, artist)
-			fmt.Printf("results unclear for %s, skipping...\n", artist.Name)
-			continue
-		}
-		fmt.Printf("Songkick ID for %s: %d\n", artist.Name, id)
-		artist.SongkickID = id
-		skmap[artist.Name] = id
-		saveSongkickData(skmap)
-	}
-
-	fmt.Printf("manual identification needed for %d artists:\n", len(notfound))
-
-	for _, artist := range manual {
-		// read from stdin until we get a valid input
-		openURL(songkickArtistURL(artist.Name))
-		for {
-			fmt.Printf("Enter Songkick ID for %s: ", artist.Name)
-			reader := bufio.NewReader(os.Stdin)
-			text, _ := reader.ReadString('\n')
-			text = strings.Trim(text, "\n ")
-
-			if text == "" {
-				fmt.Printf("marking %s as not found\n\n", artist.Name)
-				artist.SongkickID = SongkickNotFound
-				skmap[artist.Name] = SongkickNotFound
-				saveSongkickData(skmap)
-				break
-			}
-
-			id, err := strconv.Atoi(text)
-			if err != nil {
-				fmt.Printf("invalid ID %s, must be an int\n\n", text)
-				continue
-			}
-
-			artist.SongkickID = id
-			skmap[artist.Name] = id
-			saveSongkickData(skmap)
-			break
-
-		}
-	}
-}
+// Unknown marks an artist whose songkick ID hasn't been looked up yet,
+// NotFound an artist songkick doesn't know about.
+var Unknown = 0
+var NotFound = -1
@@ -1,19 +1,117 @@
-package main
+package songkick_test
 
 import (
-	"fmt"
-	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/brianloveswords/spotify/songkick"
+	"github.com/brianloveswords/spotify/songkick/songkicktest"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestSongkickParser(t *testing.T) {
-	f, _ := os.Open("sk2.html")
-	defer f.Close()
-	fmt.Println(getIDFromSongkickPage("Gleemer"))
+	client, server := songkicktest.NewClient("testdata")
+	defer server.Close()
+
+	candidates, err := client.SearchArtists("Gleemer")
+	assert.NoError(t, err)
+	assert.Len(t, candidates, 2)
+
+	assert.Equal(t, 7180534, candidates[0].ID)
+	assert.Equal(t, "Gleemer", candidates[0].Name)
+	assert.Equal(t, "Denver, CO, US", candidates[0].Snippet)
+	assert.True(t, candidates[0].OnTour)
+	assert.Equal(t, songkick.ScoreExact, candidates[0].Score)
+
+	assert.Equal(t, 9283751, candidates[1].ID)
+	assert.Equal(t, "The Gleemers", candidates[1].Name)
+	assert.False(t, candidates[1].OnTour)
+
+	best, ok := songkick.Best(candidates)
+	assert.True(t, ok)
+	assert.Equal(t, 7180534, best.ID)
+
+	_, err = client.SearchArtists("nobody we have a fixture for")
+	assert.Error(t, err)
 }
 
-func TestSongkickIDFromHref(t *testing.T) {
-	assert.Equal(t, 7180534, idFromHref("/artists/7180534-gleemer"))
+func TestClientLineup(t *testing.T) {
+	client, server := songkicktest.NewClient("testdata")
+	defer server.Close()
+
+	artists, err := client.Lineup("https://www.songkick.com/concerts/33692814-royal-trux-at-alphaville")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Royal Trux", "Gleemer", "Slow Mass"}, artists)
+}
+
+func TestClientArtistEvents(t *testing.T) {
+	client, server := songkicktest.NewClient("testdata")
+	defer server.Close()
+
+	events, err := client.ArtistEvents(7180534)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "Gleemer at The Echo (20 Oct 18)", events[0].Summary)
+	assert.Equal(t, "Royal Trux with Gleemer and Slow Mass at Alphaville (01 Dec 18)", events[1].Summary)
+	assert.Equal(t, "Alphaville, Brooklyn, NY, US", events[1].Location)
+
+	_, err = client.ArtistEvents(1)
+	assert.Error(t, err)
+}
+
+func TestIsConcertURL(t *testing.T) {
+	assert.True(t, songkick.IsConcertURL("https://www.songkick.com/concerts/33692814-royal-they-at-alphaville"))
+	assert.True(t, songkick.IsConcertURL("http://songkick.com/concerts/1234-yep"))
+	assert.False(t, songkick.IsConcertURL("https://www.songkick.com/artists/7180534-gleemer"))
+	assert.False(t, songkick.IsConcertURL("https://example.com/concerts/1234-yep"))
+}
+
+func TestParseShowPage(t *testing.T) {
+	page := `<html><body>
+	<div class="line-up">
+	  <span><a href="/artists/1-royal-they">Royal Trux</a></span>
+	  <span><a href="/artists/2-gleemer">
+	    Gleemer
+	  </a></span>
+	</div>
+	</body></html>`
+
+	artists, err := songkick.ParseShowPage(strings.NewReader(page))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Royal Trux", "Gleemer"}, artists)
+
+	_, err = songkick.ParseShowPage(strings.NewReader("<html></html>"))
+	assert.Error(t, err)
+}
+
+func TestParseCalendar(t *testing.T) {
+	feed := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20181201",
+		"SUMMARY:Gleemer at Alphaville (01 Dec 18)",
+		"LOCATION:Alphaville\\, Brooklyn\\, NY\\, US",
+		"URL:https://www.songkick.com/concerts/2-gleemer-at-alph",
+		" aville",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART:20181020T200000Z",
+		"SUMMARY:Gleemer at The Echo",
+		"LOCATION:The Echo\\, Los Angeles\\, CA\\, US",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	events, err := songkick.ParseCalendar(strings.NewReader(feed))
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+
+	assert.Equal(t, "Gleemer at The Echo", events[0].Summary)
+	assert.Equal(t, time.Date(2018, 10, 20, 20, 0, 0, 0, time.UTC), events[0].Date)
+
+	assert.Equal(t, "Alphaville, Brooklyn, NY, US", events[1].Location)
+	assert.Equal(t, "https://www.songkick.com/concerts/2-gleemer-at-alphaville", events[1].URL)
+	assert.Equal(t, time.Date(2018, 12, 1, 0, 0, 0, 0, time.UTC), events[1].Date)
 }
@@ -0,0 +1,65 @@
+// Package songkicktest serves saved songkick pages so code that scrapes
+// songkick can be tested without hitting the real site.
+package songkicktest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/brianloveswords/spotify/songkick"
+)
+
+// A fixture directory is laid out like this:
+//
+//   search/<artist-name>.html   artist search results, e.g. search/gleemer.html
+//   concerts/<id>.html          concert pages, e.g. concerts/33692814.html
+//   calendars/<id>.ics          artist calendars, e.g. calendars/7180534.ics
+//
+// Anything else is a 404.
+
+var (
+	reConcert  = regexp.MustCompile(`^/concerts/(\d+)`)
+	reCalendar = regexp.MustCompile(`^/artists/(\d+)[^/]*/calendar\.ics$`)
+)
+
+// NewServer starts a server that answers songkick requests out of the
+// fixture directory dir. Callers should Close it when they're done.
+func NewServer(dir string) *httptest.Server {
+	return httptest.NewServer(Handler(dir))
+}
+
+// NewClient starts a fixture server and returns a songkick client that
+// talks to it, along with the server so it can be closed.
+func NewClient(dir string) (*songkick.HTTPClient, *httptest.Server) {
+	server := NewServer(dir)
+	return songkick.NewHTTPClient(server.URL, server.Client()), server
+}
+
+// Handler maps songkick URLs onto files in the fixture directory.
+func Handler(dir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var file string
+		switch p := r.URL.Path; {
+		case p == "/search":
+			file = path.Join("search", Slug(r.URL.Query().Get("query"))+".html")
+		case reConcert.MatchString(p):
+			file = path.Join("concerts", reConcert.FindStringSubmatch(p)[1]+".html")
+		case reCalendar.MatchString(p):
+			file = path.Join("calendars", reCalendar.FindStringSubmatch(p)[1]+".ics")
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join(dir, filepath.FromSlash(file)))
+	})
+}
+
+// Slug turns an artist name into the name of its search fixture, e.g.
+// "The Royal They" becomes "the-royal-they".
+func Slug(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), "-")
+}
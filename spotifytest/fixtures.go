@@ -0,0 +1,128 @@
+package spotifytest
+
+import (
+	"github.com/zmb3/spotify"
+)
+
+// Album is an album along with its track list. The tracks don't need
+// their Album or Artists filled in, the server does that.
+type Album struct {
+	spotify.SimpleAlbum
+	Tracks []spotify.SimpleTrack
+}
+
+// Fixtures is everything the server knows about when it starts.
+type Fixtures struct {
+	User    spotify.PrivateUser
+	Artists []spotify.FullArtist
+	Albums  []Album
+	// Saved is the user's library as track IDs, newest first, with the
+	// time each was added.
+	Saved []Saved
+	// Playing is the ID of the track the player starts on, or empty if
+	// nothing is playing.
+	Playing spotify.ID
+	// Devices are the user's devices. The first is the active one when
+	// something is playing.
+	Devices []spotify.PlayerDevice
+}
+
+// Saved is a track in the user's library.
+type Saved struct {
+	ID      spotify.ID
+	AddedAt string
+}
+
+// DefaultFixtures returns a small catalog of two artists with a few
+// releases each, including a regional duplicate and a compilation, a
+// library of four tracks and a track playing.
+func DefaultFixtures() Fixtures {
+	gleemer := artist("gleemer", "Gleemer", "dream pop", "shoegaze")
+	trux := artist("royaltrux", "Royal Trux", "noise rock")
+
+	return Fixtures{
+		User: spotify.PrivateUser{
+			User: spotify.User{
+				ID:          "tester",
+				DisplayName: "Tester",
+				URI:         "spotify:user:tester",
+			},
+			Country: "US",
+			Product: "premium",
+		},
+		Artists: []spotify.FullArtist{gleemer, trux},
+		Albums: []Album{
+			album("anymore", "Anymore", "album", "2016-09-30", gleemer,
+				track("anymore1", "Wild Blue"),
+				track("anymore2", "Down"),
+				track("anymore3", "Flora"),
+			),
+			album("anymoreeu", "Anymore", "album", "2016-09-30", gleemer,
+				track("anymoreeu1", "Wild Blue"),
+				track("anymoreeu2", "Down"),
+				track("anymoreeu3", "Flora"),
+			),
+			album("childhood", "Childhood Home", "single", "2018-06-01", gleemer,
+				track("childhood1", "Childhood Home"),
+			),
+			album("fuzz", "Fuzz For Friends", "compilation", "2015-01-01", gleemer,
+				track("fuzz1", "Lull"),
+			),
+			album("twinfinite", "Twin Infinitives", "album", "1990-01-01", trux,
+				track("twinfinite1", "Solid Gold Too Fuckin' Bold"),
+				track("twinfinite2", "Ice Cream"),
+			),
+			album("accelerator", "Accelerator", "album", "1998-06-09", trux,
+				track("accelerator1", "The Banana Question"),
+				track("accelerator2", "Yellow Kid"),
+				track("accelerator3", "Liar"),
+			),
+		},
+		Saved: []Saved{
+			{"accelerator2", "2018-10-02T10:00:00Z"},
+			{"anymore1", "2018-10-01T10:00:00Z"},
+			{"anymore3", "2018-09-20T10:00:00Z"},
+			{"twinfinite1", "2018-08-01T10:00:00Z"},
+		},
+		Playing: "anymore2",
+		Devices: []spotify.PlayerDevice{
+			{ID: "laptop", Name: "Laptop", Type: "Computer", Volume: 50},
+			{ID: "kitchen", Name: "Kitchen", Type: "Speaker", Volume: 30},
+		},
+	}
+}
+
+func artist(id spotify.ID, name string, genres ...string) spotify.FullArtist {
+	return spotify.FullArtist{
+		SimpleArtist: spotify.SimpleArtist{
+			ID:   id,
+			Name: name,
+			URI:  spotify.URI("spotify:artist:" + string(id)),
+		},
+		Genres: genres,
+	}
+}
+
+func album(id spotify.ID, name, albumType, released string, by spotify.FullArtist, tracks ...spotify.SimpleTrack) Album {
+	return Album{
+		SimpleAlbum: spotify.SimpleAlbum{
+			ID:                   id,
+			Name:                 name,
+			URI:                  spotify.URI("spotify:album:" + string(id)),
+			AlbumType:            albumType,
+			AlbumGroup:           albumType,
+			Artists:              []spotify.SimpleArtist{by.SimpleArtist},
+			ReleaseDate:          released,
+			ReleaseDatePrecision: "day",
+		},
+		Tracks: tracks,
+	}
+}
+
+func track(id spotify.ID, name string) spotify.SimpleTrack {
+	return spotify.SimpleTrack{
+		ID:   id,
+		Name: name,
+		URI:  spotify.URI("spotify:track:" + string(id)),
+	}
+}
@@ -0,0 +1,783 @@
+// Package spotifytest is a fake of the parts of the spotify web API this
+// program uses, so commands can be tested without a spotify account.
+// Point a client at it with auth.NewClientWithBaseURL, or run the CLI
+// with SPOTIFY_API_URL set to APIURL().
+package spotifytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brianloveswords/spotify/auth"
+	"github.com/zmb3/spotify"
+	"golang.org/x/oauth2"
+)
+
+// Server is a fake spotify API serving a catalog seeded from Fixtures.
+// Changes made through the API, like saving tracks, creating playlists
+// or skipping to the next track, are kept in memory so tests can check
+// them afterwards.
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	user      spotify.PrivateUser
+	artists   []spotify.FullArtist
+	albums    []Album
+	tracks    map[spotify.ID]spotify.FullTrack
+	saved     []Saved
+	playing   spotify.ID
+	isPlaying bool
+	progress  int
+	shuffle   bool
+	repeat    string
+	devices   []spotify.PlayerDevice
+	playlists []Playlist
+	requests  []string
+}
+
+// Playlist is a playlist created on the server and the IDs of the
+// tracks added to it, in order.
+type Playlist struct {
+	spotify.FullPlaylist
+	TrackIDs []spotify.ID
+}
+
+// NewServer starts a fake API seeded with f. Callers should Close it
+// when they're done.
+func NewServer(f Fixtures) *Server {
+	s := &Server{
+		user:      f.User,
+		artists:   f.Artists,
+		tracks:    make(map[spotify.ID]spotify.FullTrack),
+		saved:     append([]Saved{}, f.Saved...),
+		playing:   f.Playing,
+		isPlaying: f.Playing != "",
+		repeat:    "off",
+		devices:   append([]spotify.PlayerDevice{}, f.Devices...),
+	}
+	if s.playing != "" && len(s.devices) > 0 {
+		s.devices[0].Active = true
+	}
+	for _, album := range f.Albums {
+		album.Tracks = append([]spotify.SimpleTrack{}, album.Tracks...)
+		for i := range album.Tracks {
+			t := &album.Tracks[i]
+			if len(t.Artists) == 0 {
+				t.Artists = album.Artists
+			}
+			if t.TrackNumber == 0 {
+				t.TrackNumber = i + 1
+			}
+			s.tracks[t.ID] = spotify.FullTrack{SimpleTrack: *t, Album: album.SimpleAlbum}
+		}
+		s.albums = append(s.albums, album)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// APIURL is the base URL to give a client in place of
+// https://api.spotify.com/v1/
+func (s *Server) APIURL() string {
+	return s.URL + "/v1/"
+}
+
+// Requests returns every request the server has seen, like
+// "PUT /v1/me/player/pause", oldest first.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+// Playlists returns the playlists created so far.
+func (s *Server) Playlists() []Playlist {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Playlist{}, s.playlists...)
+}
+
+// Saved returns the user's library, newest first.
+func (s *Server) Saved() []Saved {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Saved{}, s.saved...)
+}
+
+// Player returns the current track and whether it's playing.
+func (s *Server) Player() (track spotify.ID, playing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.playing, s.isPlaying
+}
+
+// PlayerState returns the rest of what the player is doing: how far into
+// the track it is, the shuffle and repeat settings, and the active
+// device, which is empty if there isn't one.
+func (s *Server) PlayerState() spotify.PlayerState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var state spotify.PlayerState
+	state.Progress = s.progress
+	state.ShuffleState = s.shuffle
+	state.RepeatState = s.repeat
+	if d := s.activeDevice(); d != nil {
+		state.Device = *d
+	}
+	return state
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		writeError(w, http.StatusUnauthorized, "No token provided")
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/v1/") {
+		writeError(w, http.StatusNotFound, "Service not found")
+		return
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/"), "/"), "/")
+
+	route := r.Method + " " + strings.Join(pattern(parts), "/")
+	switch route {
+	case "GET me":
+		writeJSON(w, http.StatusOK, s.user)
+	case "GET me/player":
+		s.playerState(w)
+	case "PUT me/player":
+		s.transfer(w, r)
+	case "GET me/player/currently-playing":
+		s.currentlyPlaying(w)
+	case "GET me/player/devices":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"devices": s.devices})
+	case "PUT me/player/seek", "PUT me/player/volume", "PUT me/player/shuffle", "PUT me/player/repeat":
+		s.setPlayer(w, r, parts[2])
+	case "PUT me/player/play":
+		s.play(w, r)
+	case "PUT me/player/pause":
+		s.isPlaying = false
+		w.WriteHeader(http.StatusNoContent)
+	case "POST me/player/next":
+		s.skip(w, 1)
+	case "POST me/player/previous":
+		s.skip(w, -1)
+	case "GET me/tracks":
+		s.savedTracks(w, r)
+	case "PUT me/tracks":
+		s.saveTracks(w, r)
+	case "DELETE me/tracks":
+		s.removeTracks(w, r)
+	case "GET search":
+		s.search(w, r)
+	case "GET recommendations":
+		s.recommendations(w, r)
+	case "GET tracks/:id":
+		s.track(w, spotify.ID(parts[1]))
+	case "GET artists/:id":
+		s.artist(w, spotify.ID(parts[1]))
+	case "GET artists/:id/albums":
+		s.artistAlbums(w, r, spotify.ID(parts[1]))
+	case "GET albums/:id":
+		s.album(w, spotify.ID(parts[1]))
+	case "GET albums/:id/tracks":
+		s.albumTracks(w, r, spotify.ID(parts[1]))
+	case "POST users/:id/playlists":
+		s.createPlaylist(w, r, parts[1])
+	case "POST users/:id/playlists/:id/tracks":
+		s.addToPlaylist(w, r, spotify.ID(parts[3]))
+	case "POST playlists/:id/tracks":
+		s.addToPlaylist(w, r, spotify.ID(parts[1]))
+	default:
+		writeError(w, http.StatusNotFound, "Service not found")
+	}
+}
+
+// pattern replaces the IDs in a path with :id so routes can be matched
+// with a switch, e.g. artists/xyz/albums becomes artists/:id/albums
+func pattern(parts []string) []string {
+	out := make([]string, len(parts))
+	for i, part := range parts {
+		if i%2 == 1 && parts[0] != "me" {
+			part = ":id"
+		}
+		out[i] = part
+	}
+	return out
+}
+
+func (s *Server) currentlyPlaying(w http.ResponseWriter) {
+	playing := s.currentlyPlayingJSON()
+	if playing == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeJSON(w, http.StatusOK, playing)
+}
+
+func (s *Server) playerState(w http.ResponseWriter) {
+	state := s.currentlyPlayingJSON()
+	device := s.activeDevice()
+	if state == nil || device == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	state["device"] = device
+	state["shuffle_state"] = s.shuffle
+	state["repeat_state"] = s.repeat
+	writeJSON(w, http.StatusOK, state)
+}
+
+func (s *Server) currentlyPlayingJSON() map[string]interface{} {
+	track, ok := s.tracks[s.playing]
+	if !ok {
+		return nil
+	}
+	return map[string]interface{}{
+		"timestamp":              time.Now().Unix() * 1000,
+		"progress_ms":            s.progress,
+		"is_playing":             s.isPlaying,
+		"currently_playing_type": "track",
+		"item":                   track,
+		"context": map[string]interface{}{
+			"type": "album",
+			"uri":  track.Album.URI,
+		},
+	}
+}
+
+func (s *Server) play(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		URIs []spotify.URI `json:"uris"`
+	}
+	// the body is optional, play with nothing resumes
+	json.NewDecoder(r.Body).Decode(&body)
+	if len(body.URIs) > 0 {
+		id := idFromURI(body.URIs[0])
+		if _, ok := s.tracks[id]; !ok {
+			writeError(w, http.StatusBadRequest, "Invalid track uri: "+string(body.URIs[0]))
+			return
+		}
+		s.playing = id
+		s.progress = 0
+	}
+	if s.playing == "" {
+		writeError(w, http.StatusNotFound, "Player command failed: No active device found")
+		return
+	}
+	s.isPlaying = true
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// skip moves through the album of the current track, wrapping around at
+// either end.
+func (s *Server) skip(w http.ResponseWriter, step int) {
+	current, ok := s.tracks[s.playing]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Player command failed: No active device found")
+		return
+	}
+	album := s.findAlbum(current.Album.ID)
+	n := len(album.Tracks)
+	for i, track := range album.Tracks {
+		if track.ID == current.ID {
+			s.playing = album.Tracks[(i+step+n)%n].ID
+			break
+		}
+	}
+	s.progress = 0
+	s.isPlaying = true
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) activeDevice() *spotify.PlayerDevice {
+	for i := range s.devices {
+		if s.devices[i].Active {
+			return &s.devices[i]
+		}
+	}
+	return nil
+}
+
+// setPlayer handles the player settings that take their value in the
+// query, like me/player/volume?volume_percent=40.
+func (s *Server) setPlayer(w http.ResponseWriter, r *http.Request, setting string) {
+	device := s.activeDevice()
+	if device == nil {
+		writeError(w, http.StatusNotFound, "Player command failed: No active device found")
+		return
+	}
+	q := r.URL.Query()
+	var err error
+	switch setting {
+	case "seek":
+		s.progress, err = strconv.Atoi(q.Get("position_ms"))
+	case "volume":
+		var volume int
+		volume, err = strconv.Atoi(q.Get("volume_percent"))
+		if err == nil && (volume < 0 || volume > 100) {
+			err = fmt.Errorf("out of range")
+		}
+		device.Volume = volume
+	case "shuffle":
+		s.shuffle, err = strconv.ParseBool(q.Get("state"))
+	case "repeat":
+		switch q.Get("state") {
+		case "off", "track", "context":
+			s.repeat = q.Get("state")
+		default:
+			err = fmt.Errorf("invalid state")
+		}
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid "+setting+": "+err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) transfer(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		DeviceIDs []spotify.ID `json:"device_ids"`
+		Play      bool         `json:"play"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.DeviceIDs) != 1 {
+		writeError(w, http.StatusBadRequest, "Exactly one device id is required")
+		return
+	}
+	target := -1
+	for i, d := range s.devices {
+		if d.ID == body.DeviceIDs[0] {
+			target = i
+		}
+	}
+	if target < 0 {
+		writeError(w, http.StatusNotFound, "Device not found")
+		return
+	}
+	for i := range s.devices {
+		s.devices[i].Active = i == target
+	}
+	if body.Play && s.playing != "" {
+		s.isPlaying = true
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) savedTracks(w http.ResponseWriter, r *http.Request) {
+	start, end, limit := window(r, len(s.saved), 20)
+	var items []spotify.SavedTrack
+	for _, saved := range s.saved[start:end] {
+		items = append(items, spotify.SavedTrack{
+			AddedAt:   saved.AddedAt,
+			FullTrack: s.tracks[saved.ID],
+		})
+	}
+	writePage(w, r, items, start, limit, len(s.saved))
+}
+
+func (s *Server) saveTracks(w http.ResponseWriter, r *http.Request) {
+	ids := requestIDs(r)
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, id := range ids {
+		if _, ok := s.tracks[id]; !ok {
+			writeError(w, http.StatusBadRequest, "invalid id "+string(id))
+			return
+		}
+	}
+	for _, id := range ids {
+		s.removeSaved(id)
+		s.saved = append([]Saved{{id, now}}, s.saved...)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) removeTracks(w http.ResponseWriter, r *http.Request) {
+	for _, id := range requestIDs(r) {
+		s.removeSaved(id)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) removeSaved(id spotify.ID) {
+	for i, saved := range s.saved {
+		if saved.ID == id {
+			s.saved = append(s.saved[:i], s.saved[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	q := strings.ToLower(r.URL.Query().Get("q"))
+	if q == "" {
+		writeError(w, http.StatusBadRequest, "No search query")
+		return
+	}
+	// the real thing does fuzzy matching, a substring will do here
+	matches := func(name string) bool {
+		return strings.Contains(strings.ToLower(name), q)
+	}
+
+	result := make(map[string]interface{})
+	for _, t := range strings.Split(r.URL.Query().Get("type"), ",") {
+		switch t {
+		case "artist":
+			var items []spotify.FullArtist
+			for _, artist := range s.artists {
+				if matches(artist.Name) {
+					items = append(items, artist)
+				}
+			}
+			result["artists"] = newPage(r, items, 0, len(items), len(items))
+		case "album":
+			var items []spotify.SimpleAlbum
+			for _, album := range s.albums {
+				if matches(album.Name) {
+					items = append(items, album.SimpleAlbum)
+				}
+			}
+			result["albums"] = newPage(r, items, 0, len(items), len(items))
+		case "track":
+			var items []spotify.FullTrack
+			for _, album := range s.albums {
+				for _, track := range album.Tracks {
+					if matches(track.Name) {
+						items = append(items, s.tracks[track.ID])
+					}
+				}
+			}
+			result["tracks"] = newPage(r, items, 0, len(items), len(items))
+		default:
+			writeError(w, http.StatusBadRequest, "Bad search type field "+t)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// recommendations returns tracks by the seed artists and the artists of
+// the seed tracks, in catalog order.
+func (s *Server) recommendations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	seeds := make(map[spotify.ID]bool)
+	for _, id := range splitIDs(query.Get("seed_artists")) {
+		seeds[id] = true
+	}
+	for _, id := range splitIDs(query.Get("seed_tracks")) {
+		for _, artist := range s.tracks[id].Artists {
+			seeds[artist.ID] = true
+		}
+	}
+	if len(seeds) == 0 && query.Get("seed_genres") == "" {
+		writeError(w, http.StatusBadRequest, "No seeds provided")
+		return
+	}
+
+	limit := 20
+	if n, err := strconv.Atoi(query.Get("limit")); err == nil {
+		limit = n
+	}
+	tracks := []spotify.SimpleTrack{}
+	for _, album := range s.albums {
+		for _, track := range album.Tracks {
+			if len(tracks) < limit && byAny(track.Artists, seeds) {
+				tracks = append(tracks, track)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"seeds":  []interface{}{},
+		"tracks": tracks,
+	})
+}
+
+func byAny(artists []spotify.SimpleArtist, ids map[spotify.ID]bool) bool {
+	for _, artist := range artists {
+		if ids[artist.ID] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) track(w http.ResponseWriter, id spotify.ID) {
+	track, ok := s.tracks[id]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	writeJSON(w, http.StatusOK, track)
+}
+
+func (s *Server) artist(w http.ResponseWriter, id spotify.ID) {
+	for _, artist := range s.artists {
+		if artist.ID == id {
+			writeJSON(w, http.StatusOK, artist)
+			return
+		}
+	}
+	writeError(w, http.StatusBadRequest, "invalid id")
+}
+
+var albumGroups = map[string]bool{"album": true, "single": true, "compilation": true, "appears_on": true}
+
+func (s *Server) artistAlbums(w http.ResponseWriter, r *http.Request, id spotify.ID) {
+	groups := r.URL.Query().Get("include_groups")
+	if groups == "" {
+		// older clients call it album_type
+		groups = r.URL.Query().Get("album_type")
+	}
+	include := make(map[string]bool)
+	for _, group := range strings.Split(groups, ",") {
+		if group != "" && !albumGroups[group] {
+			writeError(w, http.StatusBadRequest, "Invalid include_groups value "+group)
+			return
+		}
+		include[group] = true
+	}
+
+	var albums []spotify.SimpleAlbum
+	for _, album := range s.albums {
+		if !byAny(album.Artists, map[spotify.ID]bool{id: true}) {
+			continue
+		}
+		if groups == "" || include[album.AlbumGroup] {
+			albums = append(albums, album.SimpleAlbum)
+		}
+	}
+	start, end, limit := window(r, len(albums), 20)
+	writePage(w, r, albums[start:end], start, limit, len(albums))
+}
+
+func (s *Server) findAlbum(id spotify.ID) *Album {
+	for i := range s.albums {
+		if s.albums[i].ID == id {
+			return &s.albums[i]
+		}
+	}
+	return nil
+}
+
+func (s *Server) album(w http.ResponseWriter, id spotify.ID) {
+	album := s.findAlbum(id)
+	if album == nil {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	start, end, limit := window(nil, len(album.Tracks), 50)
+	writeJSON(w, http.StatusOK, struct {
+		spotify.SimpleAlbum
+		Tracks page `json:"tracks"`
+	}{album.SimpleAlbum, newPage(nil, album.Tracks[start:end], start, limit, len(album.Tracks))})
+}
+
+func (s *Server) albumTracks(w http.ResponseWriter, r *http.Request, id spotify.ID) {
+	album := s.findAlbum(id)
+	if album == nil {
+		writeError(w, http.StatusBadRequest, "invalid id")
+		return
+	}
+	start, end, limit := window(r, len(album.Tracks), 20)
+	writePage(w, r, album.Tracks[start:end], start, limit, len(album.Tracks))
+}
+
+func (s *Server) createPlaylist(w http.ResponseWriter, r *http.Request, userID string) {
+	if userID != s.user.ID {
+		writeError(w, http.StatusForbidden, "You cannot create a playlist for another user")
+		return
+	}
+	var body struct {
+		Name        string `json:"name"`
+		Public      *bool  `json:"public"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" {
+		writeError(w, http.StatusBadRequest, "Missing required field: name")
+		return
+	}
+
+	id := spotify.ID(fmt.Sprintf("playlist%d", len(s.playlists)+1))
+	playlist := Playlist{}
+	playlist.ID = id
+	playlist.Name = body.Name
+	playlist.Description = body.Description
+	playlist.IsPublic = body.Public == nil || *body.Public
+	playlist.Owner = s.user.User
+	playlist.URI = spotify.URI(fmt.Sprintf("spotify:user:%s:playlist:%s", userID, id))
+	playlist.SnapshotID = "snapshot0"
+	s.playlists = append(s.playlists, playlist)
+
+	writeJSON(w, http.StatusCreated, playlist.FullPlaylist)
+}
+
+func (s *Server) addToPlaylist(w http.ResponseWriter, r *http.Request, id spotify.ID) {
+	var playlist *Playlist
+	for i := range s.playlists {
+		if s.playlists[i].ID == id {
+			playlist = &s.playlists[i]
+		}
+	}
+	if playlist == nil {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+
+	var body struct {
+		URIs []spotify.URI `json:"uris"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	for _, uri := range strings.Split(r.URL.Query().Get("uris"), ",") {
+		if uri != "" {
+			body.URIs = append(body.URIs, spotify.URI(uri))
+		}
+	}
+	if len(body.URIs) > 100 {
+		writeError(w, http.StatusBadRequest, "You can add a maximum of 100 tracks per request.")
+		return
+	}
+	for _, uri := range body.URIs {
+		if _, ok := s.tracks[idFromURI(uri)]; !ok {
+			writeError(w, http.StatusBadRequest, "Invalid track uri: "+string(uri))
+			return
+		}
+	}
+	for _, uri := range body.URIs {
+		playlist.TrackIDs = append(playlist.TrackIDs, idFromURI(uri))
+	}
+	playlist.Tracks.Total = uint(len(playlist.TrackIDs))
+	playlist.SnapshotID = fmt.Sprintf("snapshot%d", len(playlist.TrackIDs))
+
+	writeJSON(w, http.StatusCreated, map[string]string{"snapshot_id": playlist.SnapshotID})
+}
+
+// requestIDs gets the IDs for a library change, which can come as a
+// query parameter or in the body.
+func requestIDs(r *http.Request) []spotify.ID {
+	ids := splitIDs(r.URL.Query().Get("ids"))
+	var body struct {
+		IDs []spotify.ID `json:"ids"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	return append(ids, body.IDs...)
+}
+
+func splitIDs(s string) (ids []spotify.ID) {
+	for _, id := range strings.Split(s, ",") {
+		if id != "" {
+			ids = append(ids, spotify.ID(id))
+		}
+	}
+	return ids
+}
+
+func idFromURI(uri spotify.URI) spotify.ID {
+	parts := strings.Split(string(uri), ":")
+	return spotify.ID(parts[len(parts)-1])
+}
+
+// page is the paging object spotify wraps lists in.
+type page struct {
+	Endpoint string      `json:"href"`
+	Items    interface{} `json:"items"`
+	Limit    int         `json:"limit"`
+	Offset   int         `json:"offset"`
+	Total    int         `json:"total"`
+	Next     *string     `json:"next"`
+	Previous *string     `json:"previous"`
+}
+
+// window works out which slice of total items a request for a page
+// wants, using its limit and offset parameters. r can be nil for the
+// first page.
+func window(r *http.Request, total, defaultLimit int) (start, end, limit int) {
+	limit = defaultLimit
+	if r != nil {
+		query := r.URL.Query()
+		if n, err := strconv.Atoi(query.Get("limit")); err == nil && n > 0 && n <= 50 {
+			limit = n
+		}
+		if n, err := strconv.Atoi(query.Get("offset")); err == nil && n > 0 {
+			start = n
+		}
+	}
+	if start > total {
+		start = total
+	}
+	end = start + limit
+	if end > total {
+		end = total
+	}
+	return start, end, limit
+}
+
+func newPage(r *http.Request, items interface{}, offset, limit, total int) page {
+	p := page{Items: items, Limit: limit, Offset: offset, Total: total}
+	if r == nil {
+		return p
+	}
+	link := func(offset int) *string {
+		u := url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path}
+		query := r.URL.Query()
+		query.Set("offset", strconv.Itoa(offset))
+		query.Set("limit", strconv.Itoa(limit))
+		u.RawQuery = query.Encode()
+		s := u.String()
+		return &s
+	}
+	p.Endpoint = *link(offset)
+	if offset+limit < total {
+		p.Next = link(offset + limit)
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		p.Previous = link(prev)
+	}
+	return p
+}
+
+func writePage(w http.ResponseWriter, r *http.Request, items interface{}, offset, limit, total int) {
+	writeJSON(w, http.StatusOK, newPage(r, items, offset, limit, total))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]spotify.Error{
+		"error": {Status: status, Message: message},
+	})
+}
+
+// NewClient starts a fake API seeded with f and returns a spotify client
+// that talks to it, along with the server so it can be closed.
+func NewClient(f Fixtures) (*spotify.Client, *Server) {
+	server := NewServer(f)
+	client, err := auth.NewClientWithBaseURL(server.APIURL(), &oauth2.Token{
+		AccessToken: "spotifytest",
+		TokenType:   "Bearer",
+	})
+	if err != nil {
+		// the URL comes from httptest, so this can't happen
+		panic(err)
+	}
+	return &client, server
+}
@@ -0,0 +1,233 @@
+package spotifytest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify"
+)
+
+// do sends a request to the server the way the spotify client would and
+// decodes the response into v, if given.
+func do(t *testing.T, s *Server, method, path string, body io.Reader, v interface{}) int {
+	req, err := http.NewRequest(method, s.APIURL()+path, body)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer test")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	if v != nil && resp.StatusCode < 300 {
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	return resp.StatusCode
+}
+
+func TestNeedsToken(t *testing.T) {
+	s := NewServer(DefaultFixtures())
+	defer s.Close()
+
+	resp, err := http.Get(s.APIURL() + "me")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestCurrentlyPlayingAndControls(t *testing.T) {
+	s := NewServer(DefaultFixtures())
+	defer s.Close()
+
+	var playing spotify.CurrentlyPlaying
+	assert.Equal(t, http.StatusOK, do(t, s, "GET", "me/player/currently-playing", nil, &playing))
+	assert.True(t, playing.Playing)
+	assert.Equal(t, "Down", playing.Item.Name)
+	assert.Equal(t, "Gleemer", playing.Item.Artists[0].Name)
+	assert.Equal(t, "Anymore", playing.Item.Album.Name)
+
+	assert.Equal(t, http.StatusNoContent, do(t, s, "PUT", "me/player/pause", nil, nil))
+	_, isPlaying := s.Player()
+	assert.False(t, isPlaying)
+
+	assert.Equal(t, http.StatusNoContent, do(t, s, "POST", "me/player/next", nil, nil))
+	track, isPlaying := s.Player()
+	assert.Equal(t, spotify.ID("anymore3"), track)
+	assert.True(t, isPlaying)
+
+	// wraps around to the start of the album
+	do(t, s, "POST", "me/player/next", nil, nil)
+	track, _ = s.Player()
+	assert.Equal(t, spotify.ID("anymore1"), track)
+
+	do(t, s, "POST", "me/player/previous", nil, nil)
+	track, _ = s.Player()
+	assert.Equal(t, spotify.ID("anymore3"), track)
+}
+
+func TestNothingPlaying(t *testing.T) {
+	f := DefaultFixtures()
+	f.Playing = ""
+	s := NewServer(f)
+	defer s.Close()
+
+	assert.Equal(t, http.StatusNoContent, do(t, s, "GET", "me/player/currently-playing", nil, nil))
+	assert.Equal(t, http.StatusNotFound, do(t, s, "PUT", "me/player/play", nil, nil))
+	assert.Equal(t, http.StatusNoContent, do(t, s, "GET", "me/player", nil, nil))
+	assert.Equal(t, http.StatusNotFound, do(t, s, "PUT", "me/player/volume?volume_percent=10", nil, nil))
+}
+
+func TestPlayerSettingsAndDevices(t *testing.T) {
+	s := NewServer(DefaultFixtures())
+	defer s.Close()
+
+	var state spotify.PlayerState
+	assert.Equal(t, http.StatusOK, do(t, s, "GET", "me/player", nil, &state))
+	assert.Equal(t, "Down", state.Item.Name)
+	assert.Equal(t, "Laptop", state.Device.Name)
+	assert.Equal(t, "off", state.RepeatState)
+
+	for _, path := range []string{
+		"me/player/seek?position_ms=90000",
+		"me/player/volume?volume_percent=70",
+		"me/player/shuffle?state=true",
+		"me/player/repeat?state=context",
+	} {
+		assert.Equal(t, http.StatusNoContent, do(t, s, "PUT", path, nil, nil), path)
+	}
+	state = s.PlayerState()
+	assert.Equal(t, 90000, state.Progress)
+	assert.Equal(t, 70, state.Device.Volume)
+	assert.True(t, state.ShuffleState)
+	assert.Equal(t, "context", state.RepeatState)
+
+	assert.Equal(t, http.StatusBadRequest, do(t, s, "PUT", "me/player/volume?volume_percent=101", nil, nil))
+	assert.Equal(t, http.StatusBadRequest, do(t, s, "PUT", "me/player/repeat?state=album", nil, nil))
+
+	var devices struct {
+		Devices []spotify.PlayerDevice `json:"devices"`
+	}
+	do(t, s, "GET", "me/player/devices", nil, &devices)
+	assert.Len(t, devices.Devices, 2)
+
+	assert.Equal(t, http.StatusNotFound,
+		do(t, s, "PUT", "me/player", strings.NewReader(`{"device_ids": ["phone"]}`), nil))
+	assert.Equal(t, "Laptop", s.PlayerState().Device.Name)
+	assert.Equal(t, http.StatusNoContent,
+		do(t, s, "PUT", "me/player", strings.NewReader(`{"device_ids": ["kitchen"]}`), nil))
+	assert.Equal(t, "Kitchen", s.PlayerState().Device.Name)
+}
+
+func TestSearch(t *testing.T) {
+	s := NewServer(DefaultFixtures())
+	defer s.Close()
+
+	var result spotify.SearchResult
+	do(t, s, "GET", "search?q=royal&type=artist", nil, &result)
+	assert.Len(t, result.Artists.Artists, 1)
+	assert.Equal(t, spotify.ID("royaltrux"), result.Artists.Artists[0].ID)
+	assert.Nil(t, result.Tracks)
+
+	result = spotify.SearchResult{}
+	do(t, s, "GET", "search?q=wild&type=track,artist", nil, &result)
+	assert.Len(t, result.Tracks.Tracks, 2)
+	assert.Len(t, result.Artists.Artists, 0)
+}
+
+func TestArtistAlbumsPaging(t *testing.T) {
+	s := NewServer(DefaultFixtures())
+	defer s.Close()
+
+	var page spotify.SimpleAlbumPage
+	do(t, s, "GET", "artists/gleemer/albums?include_groups=album,single&limit=2", nil, &page)
+	assert.Equal(t, 3, page.Total)
+	assert.Len(t, page.Albums, 2)
+	assert.Contains(t, page.Next, "offset=2")
+
+	page = spotify.SimpleAlbumPage{}
+	do(t, s, "GET", "artists/gleemer/albums?include_groups=album,single&limit=2&offset=2", nil, &page)
+	assert.Len(t, page.Albums, 1)
+	assert.Equal(t, "Childhood Home", page.Albums[0].Name)
+	assert.Equal(t, "", page.Next)
+
+	page = spotify.SimpleAlbumPage{}
+	do(t, s, "GET", "artists/gleemer/albums?album_type=compilation", nil, &page)
+	assert.Len(t, page.Albums, 1)
+	assert.Equal(t, "Fuzz For Friends", page.Albums[0].Name)
+
+	assert.Equal(t, http.StatusBadRequest, do(t, s, "GET", "artists/gleemer/albums?include_groups=bootleg", nil, nil))
+}
+
+func TestAlbumTracks(t *testing.T) {
+	s := NewServer(DefaultFixtures())
+	defer s.Close()
+
+	var page spotify.SimpleTrackPage
+	do(t, s, "GET", "albums/accelerator/tracks", nil, &page)
+	assert.Equal(t, 3, page.Total)
+	assert.Equal(t, "The Banana Question", page.Tracks[0].Name)
+	assert.Equal(t, "Royal Trux", page.Tracks[0].Artists[0].Name)
+	assert.Equal(t, 2, page.Tracks[1].TrackNumber)
+}
+
+func TestRecommendations(t *testing.T) {
+	s := NewServer(DefaultFixtures())
+	defer s.Close()
+
+	var recs spotify.Recommendations
+	do(t, s, "GET", "recommendations?seed_tracks=accelerator1&limit=3", nil, &recs)
+	assert.Len(t, recs.Tracks, 3)
+	for _, track := range recs.Tracks {
+		assert.Equal(t, "Royal Trux", track.Artists[0].Name)
+	}
+	assert.Equal(t, http.StatusBadRequest, do(t, s, "GET", "recommendations", nil, nil))
+}
+
+func TestPlaylists(t *testing.T) {
+	s := NewServer(DefaultFixtures())
+	defer s.Close()
+
+	var user spotify.PrivateUser
+	do(t, s, "GET", "me", nil, &user)
+	assert.Equal(t, "tester", user.ID)
+
+	var playlist spotify.FullPlaylist
+	status := do(t, s, "POST", "users/tester/playlists", strings.NewReader(`{"name":"mix","public":false}`), &playlist)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "mix", playlist.Name)
+	assert.False(t, playlist.IsPublic)
+
+	status = do(t, s, "POST", "users/tester/playlists/"+string(playlist.ID)+"/tracks",
+		strings.NewReader(`{"uris":["spotify:track:anymore1","spotify:track:fuzz1"]}`), nil)
+	assert.Equal(t, http.StatusCreated, status)
+
+	status = do(t, s, "POST", "users/tester/playlists/"+string(playlist.ID)+"/tracks",
+		strings.NewReader(`{"uris":["spotify:track:nope"]}`), nil)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	playlists := s.Playlists()
+	assert.Len(t, playlists, 1)
+	assert.Equal(t, []spotify.ID{"anymore1", "fuzz1"}, playlists[0].TrackIDs)
+
+	assert.Equal(t, http.StatusForbidden, do(t, s, "POST", "users/someone/playlists", strings.NewReader(`{"name":"x"}`), nil))
+}
+
+func TestSavedTracks(t *testing.T) {
+	s := NewServer(DefaultFixtures())
+	defer s.Close()
+
+	var page spotify.SavedTrackPage
+	do(t, s, "GET", "me/tracks?limit=2", nil, &page)
+	assert.Equal(t, 4, page.Total)
+	assert.Len(t, page.Tracks, 2)
+	assert.Equal(t, "Yellow Kid", page.Tracks[0].Name)
+	assert.Equal(t, "2018-10-02T10:00:00Z", page.Tracks[0].AddedAt)
+
+	assert.Equal(t, http.StatusOK, do(t, s, "PUT", "me/tracks?ids=fuzz1", nil, nil))
+	saved := s.Saved()
+	assert.Len(t, saved, 5)
+	assert.Equal(t, spotify.ID("fuzz1"), saved[0].ID)
+
+	assert.Equal(t, http.StatusBadRequest, do(t, s, "PUT", "me/tracks?ids=nope", nil, nil))
+	assert.Len(t, s.Saved(), 5)
+}
@@ -0,0 +1,220 @@
+package util
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/brianloveswords/spotify/fetch"
+	"github.com/brianloveswords/spotify/logger"
+	"github.com/zmb3/spotify"
+)
+
+// DefaultAlbumTypes is what we look at when nobody says otherwise: the
+// artist's own albums and singles, no compilations or guest spots.
+const DefaultAlbumTypes = spotify.AlbumTypeAlbum | spotify.AlbumTypeSingle
+
+// AllAlbumTypes includes compilations and releases the artist only
+// appears on, like features and splits.
+const AllAlbumTypes = spotify.AlbumTypeAlbum | spotify.AlbumTypeSingle |
+	spotify.AlbumTypeCompilation | spotify.AlbumTypeAppearsOn
+
+var albumTypeNames = map[string]spotify.AlbumType{
+	"album":       spotify.AlbumTypeAlbum,
+	"single":      spotify.AlbumTypeSingle,
+	"compilation": spotify.AlbumTypeCompilation,
+	"appears_on":  spotify.AlbumTypeAppearsOn,
+}
+
+// ParseAlbumTypes turns a comma separated list like "album,single" into
+// an album type filter. "all" is shorthand for every type.
+func ParseAlbumTypes(s string) (spotify.AlbumType, error) {
+	var types spotify.AlbumType
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name == "all" {
+			return AllAlbumTypes, nil
+		}
+		t, ok := albumTypeNames[strings.Replace(name, "-", "_", -1)]
+		if !ok {
+			return 0, fmt.Errorf("unknown album type %q, expected album, single, compilation or appears_on", name)
+		}
+		types |= t
+	}
+	if types == 0 {
+		return 0, fmt.Errorf("no album types given")
+	}
+	return types, nil
+}
+
+// albumPageSize is the most albums spotify returns per page.
+const albumPageSize = 50
+
+// GetAllAlbumsByArtist pages through every release of the given types
+// by the artist and drops duplicates, like the same album released
+// separately in different regions, or a remaster with the same tracks.
+func GetAllAlbumsByArtist(client Catalog, artistID spotify.ID, types spotify.AlbumType) ([]spotify.SimpleAlbum, error) {
+	defer glog.Enter("util.GetAllAlbumsByArtist")()
+	return getAllAlbumsByArtist(client, artistID, types, func(id spotify.ID) ([]spotify.SimpleTrack, error) {
+		return GetAlbumTracks(client, id)
+	})
+}
+
+// getAllAlbumsByArtist is GetAllAlbumsByArtist, fetching the tracks it
+// needs to spot duplicates with getTracks.
+func getAllAlbumsByArtist(client Catalog, artistID spotify.ID, types spotify.AlbumType, getTracks func(spotify.ID) ([]spotify.SimpleTrack, error)) ([]spotify.SimpleAlbum, error) {
+	// TODO: ensure artistID looks like an artistID
+
+	fetchPage := func(offset int) (*spotify.SimpleAlbumPage, error) {
+		limit := albumPageSize
+		return client.GetArtistAlbumsOpt(artistID, &spotify.Options{
+			Limit:  &limit,
+			Offset: &offset,
+		}, &types)
+	}
+
+	first, err := fetchPage(0)
+	if err != nil {
+		glog.Debug("error getting albums for artist by id %s", artistID)
+		return nil, err
+	}
+
+	npages := (first.Total + albumPageSize - 1) / albumPageSize
+	pages := make([]*spotify.SimpleAlbumPage, npages)
+	if npages > 0 {
+		pages[0] = first
+	}
+	err = fetch.Map(context.Background(), npages-1, fetch.DefaultWorkers, func(ctx context.Context, i int) (err error) {
+		offset := (i + 1) * albumPageSize
+		ctx, done := glog.EnterContext(logger.WithFields(ctx, "offset", offset), "util.GetArtistAlbumsOpt")
+		defer done()
+		if pages[i+1], err = fetchPage(offset); err != nil {
+			glog.Context(ctx).Debug("error getting albums: %s", err)
+		}
+		return err
+	})
+	if err != nil {
+		glog.Debug("error getting albums for artist by id %s", artistID)
+		return nil, err
+	}
+
+	var albums []spotify.SimpleAlbum
+	for _, page := range pages {
+		albums = append(albums, page.Albums...)
+	}
+	glog.Debug("found %d releases for %s", len(albums), artistID)
+
+	return dedupeAlbums(albums, getTracks)
+}
+
+// albumTrackPageSize is the most tracks spotify returns per page of an
+// album.
+const albumTrackPageSize = 50
+
+// GetAlbumTracks returns every track on the album. One request only
+// gets the first page, so long albums would otherwise be cut short.
+func GetAlbumTracks(client Catalog, id spotify.ID) ([]spotify.SimpleTrack, error) {
+	var tracks []spotify.SimpleTrack
+	for {
+		page, err := client.GetAlbumTracksOpt(id, albumTrackPageSize, len(tracks))
+		if err != nil {
+			return nil, err
+		}
+		tracks = append(tracks, page.Tracks...)
+		if page.Next == "" || len(page.Tracks) == 0 {
+			return tracks, nil
+		}
+	}
+}
+
+// dedupeAlbums drops releases that have the same name and the same track
+// list as one earlier in the list. Tracks are only fetched for albums
+// whose names collide, since that's rare.
+func dedupeAlbums(albums []spotify.SimpleAlbum, getTracks func(spotify.ID) ([]spotify.SimpleTrack, error)) ([]spotify.SimpleAlbum, error) {
+	byName := make(map[string][]int)
+	for i, album := range albums {
+		key := normalizeReleaseName(album.Name)
+		byName[key] = append(byName[key], i)
+	}
+
+	tracklists := make(map[spotify.ID][]string)
+	tracklist := func(id spotify.ID) ([]string, error) {
+		if names, ok := tracklists[id]; ok {
+			return names, nil
+		}
+		tracks, err := getTracks(id)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, track := range tracks {
+			names = append(names, normalizeReleaseName(track.Name))
+		}
+		tracklists[id] = names
+		return names, nil
+	}
+
+	duplicate := make(map[int]bool)
+	for _, group := range byName {
+		if len(group) < 2 {
+			continue
+		}
+		for j, b := range group {
+			for _, a := range group[:j] {
+				if duplicate[a] {
+					continue
+				}
+				same, err := sameTracklist(tracklist, albums[a].ID, albums[b].ID)
+				if err != nil {
+					return nil, err
+				}
+				if same {
+					glog.Debug("dropping %s (%s), same as %s", albums[b].Name, albums[b].ID, albums[a].ID)
+					duplicate[b] = true
+					break
+				}
+			}
+		}
+	}
+
+	var results []spotify.SimpleAlbum
+	for i, album := range albums {
+		if !duplicate[i] {
+			results = append(results, album)
+		}
+	}
+	return results, nil
+}
+
+func sameTracklist(tracklist func(spotify.ID) ([]string, error), a, b spotify.ID) (bool, error) {
+	ta, err := tracklist(a)
+	if err != nil {
+		return false, err
+	}
+	tb, err := tracklist(b)
+	if err != nil {
+		return false, err
+	}
+	if len(ta) != len(tb) {
+		return false, nil
+	}
+	for i := range ta {
+		if ta[i] != tb[i] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// reReissue matches the bits spotify tacks on to reissued albums and
+// tracks, e.g. "Blue Train (Remastered)" or "Moment's Notice - Remastered
+// 2003"
+var reReissue = regexp.MustCompile(`(?i)\s*([(\[]|\s-\s).*\b(remaster(ed)?|deluxe|expanded|anniversary|edition|version|mono|stereo)\b.*$`)
+
+func normalizeReleaseName(name string) string {
+	return strings.ToLower(strings.TrimSpace(reReissue.ReplaceAllString(name, "")))
+}
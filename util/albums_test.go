@@ -0,0 +1,162 @@
+package util
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify"
+)
+
+func TestParseAlbumTypes(t *testing.T) {
+	types, err := ParseAlbumTypes("album,single")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultAlbumTypes, types)
+
+	types, err = ParseAlbumTypes("compilation, appears-on")
+	assert.NoError(t, err)
+	assert.Equal(t, spotify.AlbumTypeCompilation|spotify.AlbumTypeAppearsOn, types)
+
+	types, err = ParseAlbumTypes("all")
+	assert.NoError(t, err)
+	assert.Equal(t, AllAlbumTypes, types)
+
+	_, err = ParseAlbumTypes("bootleg")
+	assert.Error(t, err)
+	_, err = ParseAlbumTypes("")
+	assert.Error(t, err)
+}
+
+func TestNormalizeReleaseName(t *testing.T) {
+	for name, expect := range map[string]string{
+		"Blue Train":                           "blue train",
+		"Blue Train (Remastered)":              "blue train",
+		"Blue Train [Deluxe Edition]":          "blue train",
+		"Moment's Notice - Remastered 2003":    "moment's notice",
+		"Time Out (Live)":                      "time out (live)",
+		"Love Supreme - 50th Anniversary Mono": "love supreme",
+	} {
+		assert.Equal(t, expect, normalizeReleaseName(name), name)
+	}
+}
+
+func TestDedupeAlbums(t *testing.T) {
+	albums := []spotify.SimpleAlbum{
+		{ID: "us", Name: "Blue Train"},
+		{ID: "eu", Name: "Blue Train"},
+		{ID: "remaster", Name: "Blue Train (Remastered)"},
+		{ID: "deluxe", Name: "Blue Train (Deluxe Edition)"},
+		{ID: "other", Name: "Giant Steps"},
+	}
+	tracklists := map[spotify.ID][]string{
+		"us":       {"Blue Train", "Moment's Notice"},
+		"eu":       {"Blue Train", "Moment's Notice"},
+		"remaster": {"Blue Train - Remastered", "Moment's Notice - Remastered"},
+		"deluxe":   {"Blue Train", "Moment's Notice", "Blue Train (Alternate Take)"},
+	}
+	var fetched []spotify.ID
+	getTracks := func(id spotify.ID) ([]spotify.SimpleTrack, error) {
+		fetched = append(fetched, id)
+		var tracks []spotify.SimpleTrack
+		for _, name := range tracklists[id] {
+			tracks = append(tracks, spotify.SimpleTrack{Name: name})
+		}
+		return tracks, nil
+	}
+
+	deduped, err := dedupeAlbums(albums, getTracks)
+	assert.NoError(t, err)
+
+	var ids []spotify.ID
+	for _, album := range deduped {
+		ids = append(ids, album.ID)
+	}
+	assert.Equal(t, []spotify.ID{"us", "deluxe", "other"}, ids)
+	assert.NotContains(t, fetched, spotify.ID("other"))
+}
+
+// pagedAlbum serves an album's tracks a page at a time, like spotify.
+type pagedAlbum struct {
+	Catalog
+	tracks []spotify.SimpleTrack
+}
+
+func (p *pagedAlbum) GetAlbumTracksOpt(id spotify.ID, limit, offset int) (*spotify.SimpleTrackPage, error) {
+	end := offset + limit
+	if end > len(p.tracks) {
+		end = len(p.tracks)
+	}
+	page := &spotify.SimpleTrackPage{Tracks: p.tracks[offset:end]}
+	if end < len(p.tracks) {
+		page.Next = "more"
+	}
+	return page, nil
+}
+
+func TestGetAlbumTracksPages(t *testing.T) {
+	album := &pagedAlbum{}
+	for i := 0; i < 120; i++ {
+		album.tracks = append(album.tracks, spotify.SimpleTrack{TrackNumber: i + 1})
+	}
+	tracks, err := GetAlbumTracks(album, "long")
+	assert.NoError(t, err)
+	assert.Equal(t, album.tracks, tracks)
+}
+
+// discography is an artist with a few releases that counts how often
+// each album's tracks are asked for.
+type discography struct {
+	Catalog
+	albums  []spotify.SimpleAlbum
+	tracks  map[spotify.ID][]spotify.SimpleTrack
+	mu      sync.Mutex
+	fetched map[spotify.ID]int
+}
+
+func (d *discography) GetArtistAlbumsOpt(artistID spotify.ID, options *spotify.Options, t *spotify.AlbumType) (*spotify.SimpleAlbumPage, error) {
+	page := &spotify.SimpleAlbumPage{Albums: d.albums}
+	page.Total = len(d.albums)
+	return page, nil
+}
+
+func (d *discography) GetAlbumTracksOpt(id spotify.ID, limit, offset int) (*spotify.SimpleTrackPage, error) {
+	d.mu.Lock()
+	d.fetched[id]++
+	d.mu.Unlock()
+	tracks, ok := d.tracks[id]
+	if !ok {
+		return nil, fmt.Errorf("no album %s", id)
+	}
+	return &spotify.SimpleTrackPage{Tracks: tracks}, nil
+}
+
+func TestGetAllTracksByArtist(t *testing.T) {
+	coltrane := []spotify.SimpleArtist{{ID: "coltrane"}}
+	d := &discography{
+		albums: []spotify.SimpleAlbum{
+			{ID: "us", Name: "Blue Train"},
+			{ID: "eu", Name: "Blue Train"},
+			{ID: "split", Name: "Giant Steps"},
+		},
+		tracks: map[spotify.ID][]spotify.SimpleTrack{
+			"us": {{ID: "blue", Name: "Blue Train", Artists: coltrane}},
+			"eu": {{ID: "blue-eu", Name: "Blue Train", Artists: coltrane}},
+			"split": {
+				{ID: "giant", Name: "Giant Steps", Artists: coltrane},
+				{ID: "other", Name: "Someone Else", Artists: []spotify.SimpleArtist{{ID: "other"}}},
+			},
+		},
+		fetched: make(map[spotify.ID]int),
+	}
+
+	tracks, err := GetAllTracksByArtist(d, "coltrane", DefaultAlbumTypes)
+	assert.NoError(t, err)
+	assert.Equal(t, []spotify.ID{"blue", "giant"}, TracksToIDs(tracks))
+	assert.Equal(t, map[spotify.ID]int{"us": 1, "eu": 1, "split": 1}, d.fetched,
+		"tracks fetched while deduping shouldn't be fetched again")
+
+	delete(d.tracks, "split")
+	_, err = GetAllTracksByArtist(d, "coltrane", DefaultAlbumTypes)
+	assert.Error(t, err)
+}
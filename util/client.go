@@ -0,0 +1,33 @@
+package util
+
+import (
+	"github.com/zmb3/spotify"
+)
+
+// NowPlaying is the part of the spotify client that asks what's
+// playing. Taking the smallest interface that does the job, rather than
+// a *spotify.Client, lets tests pass in a fake.
+type NowPlaying interface {
+	PlayerCurrentlyPlaying() (*spotify.CurrentlyPlaying, error)
+}
+
+// Catalog is the part of the spotify client that looks up artists and
+// their releases.
+type Catalog interface {
+	Search(query string, t spotify.SearchType) (*spotify.SearchResult, error)
+	GetArtistAlbumsOpt(artistID spotify.ID, options *spotify.Options, t *spotify.AlbumType) (*spotify.SimpleAlbumPage, error)
+	GetAlbumTracksOpt(id spotify.ID, limit, offset int) (*spotify.SimpleTrackPage, error)
+}
+
+// Player is the part of the spotify client that controls playback on
+// the user's devices.
+type Player interface {
+	NowPlaying
+	PlayerState() (*spotify.PlayerState, error)
+	PlayerDevices() ([]spotify.PlayerDevice, error)
+	Seek(position int) error
+	Volume(percent int) error
+	Shuffle(shuffle bool) error
+	Repeat(state string) error
+	TransferPlayback(deviceID spotify.ID, play bool) error
+}
@@ -0,0 +1,133 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+// ParseSeek parses where seek should go: a number of seconds or a
+// m:ss time, either from the start of the track or, with a leading + or
+// -, from progress. It never goes back past the start.
+func ParseSeek(arg string, progress time.Duration) (time.Duration, error) {
+	s := arg
+	sign := 0
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		sign = 1
+		if s[0] == '-' {
+			sign = -1
+		}
+		s = s[1:]
+	}
+
+	var seconds int
+	var err error
+	if i := strings.Index(s, ":"); i >= 0 {
+		var m, sec int
+		m, err = strconv.Atoi(s[:i])
+		if err == nil {
+			sec, err = strconv.Atoi(s[i+1:])
+		}
+		if err == nil && (sec < 0 || sec >= 60 || len(s[i+1:]) != 2) {
+			err = fmt.Errorf("seconds out of range")
+		}
+		seconds = m*60 + sec
+	} else {
+		seconds, err = strconv.Atoi(s)
+	}
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("couldn't parse %q as seconds or m:ss", arg)
+	}
+
+	d := time.Duration(seconds) * time.Second
+	if sign != 0 {
+		d = progress + time.Duration(sign)*d
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d, nil
+}
+
+// ParseVolume parses a volume percentage, either as a number from 0 to
+// 100 or, with a leading + or -, as a change from current. Changes past
+// either end stop there.
+func ParseVolume(arg string, current int) (int, error) {
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't parse %q as a volume from 0 to 100", arg)
+	}
+	if strings.HasPrefix(arg, "+") || strings.HasPrefix(arg, "-") {
+		n += current
+	} else if n > 100 {
+		return 0, fmt.Errorf("volume %d is more than 100", n)
+	}
+	if n < 0 {
+		n = 0
+	}
+	if n > 100 {
+		n = 100
+	}
+	return n, nil
+}
+
+// ParseShuffle parses on, off or toggle, which flips current.
+func ParseShuffle(arg string, current bool) (bool, error) {
+	switch arg {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	case "toggle":
+		return !current, nil
+	}
+	return false, fmt.Errorf("expected on, off or toggle, not %q", arg)
+}
+
+// RepeatStates are what repeat can be set to, as spotify names them.
+var RepeatStates = []string{"off", "track", "context"}
+
+// ParseRepeat checks arg is one of RepeatStates.
+func ParseRepeat(arg string) (string, error) {
+	for _, state := range RepeatStates {
+		if arg == state {
+			return state, nil
+		}
+	}
+	return "", fmt.Errorf("expected %s, not %q", strings.Join(RepeatStates, ", "), arg)
+}
+
+// FindDevice finds the device called name, ignoring case. If none are
+// called exactly that, a device whose name starts with it will do, as
+// long as there's only one.
+func FindDevice(devices []spotify.PlayerDevice, name string) (spotify.PlayerDevice, error) {
+	var matches []spotify.PlayerDevice
+	for _, d := range devices {
+		if strings.EqualFold(d.Name, name) {
+			return d, nil
+		}
+		if strings.HasPrefix(strings.ToLower(d.Name), strings.ToLower(name)) {
+			matches = append(matches, d)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return spotify.PlayerDevice{}, fmt.Errorf("no device called %q", name)
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, len(matches))
+	for i, d := range matches {
+		names[i] = d.Name
+	}
+	return spotify.PlayerDevice{}, fmt.Errorf("%q could be any of %s", name, strings.Join(names, ", "))
+}
+
+// FormatDuration formats d like spotify does, m:ss.
+func FormatDuration(d time.Duration) string {
+	s := int(d / time.Second)
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
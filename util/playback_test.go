@@ -0,0 +1,94 @@
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zmb3/spotify"
+)
+
+func TestParseSeek(t *testing.T) {
+	progress := 65 * time.Second
+	for arg, expect := range map[string]time.Duration{
+		"90":    90 * time.Second,
+		"1:30":  90 * time.Second,
+		"0:05":  5 * time.Second,
+		"+10":   75 * time.Second,
+		"-10":   55 * time.Second,
+		"+1:00": 125 * time.Second,
+		"-2:00": 0,
+	} {
+		d, err := ParseSeek(arg, progress)
+		assert.NoError(t, err, arg)
+		assert.Equal(t, expect, d, arg)
+	}
+	for _, arg := range []string{"", "+", "soon", "1:5", "1:60", "1:-5", "-1:2:3"} {
+		_, err := ParseSeek(arg, progress)
+		assert.Error(t, err, arg)
+	}
+}
+
+func TestParseVolume(t *testing.T) {
+	for arg, expect := range map[string]int{
+		"0":   0,
+		"100": 100,
+		"+10": 50,
+		"-10": 30,
+		"+90": 100,
+		"-90": 0,
+	} {
+		n, err := ParseVolume(arg, 40)
+		assert.NoError(t, err, arg)
+		assert.Equal(t, expect, n, arg)
+	}
+	for _, arg := range []string{"", "loud", "101", "50%"} {
+		_, err := ParseVolume(arg, 40)
+		assert.Error(t, err, arg)
+	}
+}
+
+func TestParseShuffleAndRepeat(t *testing.T) {
+	on, err := ParseShuffle("toggle", false)
+	assert.NoError(t, err)
+	assert.True(t, on)
+	on, err = ParseShuffle("off", true)
+	assert.NoError(t, err)
+	assert.False(t, on)
+	_, err = ParseShuffle("yes", false)
+	assert.Error(t, err)
+
+	state, err := ParseRepeat("context")
+	assert.NoError(t, err)
+	assert.Equal(t, "context", state)
+	_, err = ParseRepeat("album")
+	assert.Error(t, err)
+}
+
+func TestFindDevice(t *testing.T) {
+	devices := []spotify.PlayerDevice{
+		{ID: "1", Name: "Kitchen"},
+		{ID: "2", Name: "Kitchen Radio"},
+		{ID: "3", Name: "Laptop"},
+	}
+
+	d, err := FindDevice(devices, "kitchen")
+	assert.NoError(t, err)
+	assert.Equal(t, spotify.ID("1"), d.ID)
+
+	d, err = FindDevice(devices, "lap")
+	assert.NoError(t, err)
+	assert.Equal(t, spotify.ID("3"), d.ID)
+
+	_, err = FindDevice(devices, "kit")
+	assert.EqualError(t, err, `"kit" could be any of Kitchen, Kitchen Radio`)
+
+	_, err = FindDevice(devices, "phone")
+	assert.Error(t, err)
+}
+
+func TestFormatDuration(t *testing.T) {
+	assert.Equal(t, "0:00", FormatDuration(0))
+	assert.Equal(t, "1:05", FormatDuration(65*time.Second))
+	assert.Equal(t, "60:00", FormatDuration(time.Hour))
+}
@@ -1,7 +1,7 @@
 package util
 
 import (
-	"encoding/gob"
+	"context"
 	"fmt"
 	"math/rand"
 	"os"
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/brianloveswords/spotify/fetch"
 	"github.com/brianloveswords/spotify/logger"
 	"github.com/fatih/color"
 	"github.com/lpabon/godbc"
@@ -33,29 +34,6 @@ func MustCreate(filename string) *os.File {
 	return f
 }
 
-func LoadIntMap(name string) (intmap map[string]int) {
-	f, err := os.Open(name)
-	if err != nil {
-		return make(map[string]int)
-	}
-	defer f.Close()
-	dec := gob.NewDecoder(f)
-	if err := dec.Decode(&intmap); err != nil {
-		panic(err.Error())
-	}
-	return intmap
-}
-
-func SaveIntMap(name string, intmap map[string]int) {
-	f := MustCreate(name)
-	defer f.Close()
-
-	enc := gob.NewEncoder(f)
-	if err := enc.Encode(intmap); err != nil {
-		panic(err)
-	}
-}
-
 func OpenURL(url string, fallback bool) {
 	cmd := exec.Command("open", url)
 	if err := cmd.Run(); err != nil && fallback {
@@ -96,14 +74,6 @@ func TracksToIDs(tracks []spotify.SimpleTrack) (ids []spotify.ID) {
 	return ids
 }
 
-func MustGetCurrentlyPlaying(client *spotify.Client, glog logger.Logger) *spotify.FullTrack {
-	playing, err := client.PlayerCurrentlyPlaying()
-	if err != nil {
-		glog.Fatal("could not get currently playing: %s", err)
-	}
-	return playing.Item
-}
-
 func RandomTracks(tracks []spotify.SimpleTrack, n int) (results []spotify.SimpleTrack) {
 	max := len(tracks)
 
@@ -128,22 +98,45 @@ func RandomTracks(tracks []spotify.SimpleTrack, n int) (results []spotify.Simple
 	return results
 }
 
-func GetAllTracksByArtist(client *spotify.Client, artistID spotify.ID) (alltracks []spotify.SimpleTrack, err error) {
+// GetAllTracksByArtist returns every track the artist plays on from
+// their releases of the given types, e.g. DefaultAlbumTypes.
+func GetAllTracksByArtist(client Catalog, artistID spotify.ID, types spotify.AlbumType) (alltracks []spotify.SimpleTrack, err error) {
 	defer glog.Enter("util.GetAllTracksByArtist")()
 
-	albums, err := GetAllAlbumsByArtist(client, artistID)
+	// deduping fetches the tracks of albums with the same name, keep
+	// them so we don't have to ask for them again
+	fetched := make(map[spotify.ID][]spotify.SimpleTrack)
+	albums, err := getAllAlbumsByArtist(client, artistID, types, func(id spotify.ID) ([]spotify.SimpleTrack, error) {
+		tracks, err := GetAlbumTracks(client, id)
+		if err == nil {
+			fetched[id] = tracks
+		}
+		return tracks, err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	for _, album := range albums {
-		page, err := client.GetAlbumTracks(album.ID)
-		if err != nil {
-			glog.Log("couldn't get tracks for %s (%s): %s", album.Name, album.ID, err)
-			continue
+	tracklists := make([][]spotify.SimpleTrack, len(albums))
+	err = fetch.Map(context.Background(), len(albums), fetch.DefaultWorkers, func(ctx context.Context, i int) (err error) {
+		album := albums[i]
+		if tracks, ok := fetched[album.ID]; ok {
+			tracklists[i] = tracks
+			return nil
+		}
+		ctx, done := glog.EnterContext(logger.WithFields(ctx, "album", album.ID), "util.GetAlbumTracks")
+		defer done()
+		if tracklists[i], err = GetAlbumTracks(client, album.ID); err != nil {
+			glog.Context(ctx).Debug("couldn't get tracks for %s (%s): %s", album.Name, album.ID, err)
 		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		for _, track := range page.Tracks {
+	for _, tracks := range tracklists {
+		for _, track := range tracks {
 			// an album that's attributed to an artist might be a split,
 			// so we don't want to add all the songs on the record, just
 			// the ones by the artist we're lookin for
@@ -153,32 +146,11 @@ func GetAllTracksByArtist(client *spotify.Client, artistID spotify.ID) (alltrack
 				}
 			}
 		}
-
 	}
 
 	return alltracks, nil
 }
-func GetAllAlbumsByArtist(client *spotify.Client, artistID spotify.ID) ([]spotify.SimpleAlbum, error) {
-	defer glog.Enter("util.GetAllAlbumsByArtist")()
-	// TODO: ensure artistID looks like an artistID
-
-	// TODO: some artists may have more than 50 albums but fuck them
-	limit := 50
-	// TODO: limit to singles and albums or else a lot more artists are
-	// going to get more than 50 results and we don't wanna deal with
-	// that right now
-	albumType := spotify.AlbumTypeSingle | spotify.AlbumTypeAlbum
-	page, err := client.GetArtistAlbumsOpt(artistID, &spotify.Options{
-		Limit: &limit,
-	}, &albumType)
-	if err != nil {
-		glog.Debug("error getting albums for artist by id %s", artistID)
-		return nil, err
-	}
-	return page.Albums, nil
-}
-
-func FindArtistID(c *spotify.Client, artist string) *spotify.ID {
+func FindArtistID(c Catalog, artist string) *spotify.ID {
 	page, err := c.Search(artist, spotify.SearchTypeArtist)
 	if err != nil {
 		panic(err)
@@ -197,9 +169,10 @@ func FindArtistID(c *spotify.Client, artist string) *spotify.ID {
 	return nil
 }
 
-func LogCurrentTrack(client *spotify.Client, glog logger.Logger, prefix string) {
+func LogCurrentTrack(client NowPlaying, glog *logger.Logger, prefix string) {
 	playing, _ := client.PlayerCurrentlyPlaying()
-	if playing != nil {
+	// episodes and ads come back without an item
+	if playing != nil && playing.Item != nil {
 		song := SongAttributionFromTrack(playing.Item)
 		glog.Log("%s %s", prefix, color.CyanString(song))
 	}
@@ -0,0 +1,62 @@
+package xdg
+
+import (
+	"io"
+	"path"
+
+	"github.com/spf13/afero"
+)
+
+// writeAtomic replaces file with what write writes, going through a
+// temporary file that's synced and then renamed over it. Readers see
+// either the old file or the whole new one, never an empty or torn file,
+// even if the process dies halfway or another one is writing the same
+// file.
+func (a *App) writeAtomic(file string, write func(io.Writer) error) error {
+	dir, base := path.Split(file)
+	if err := a.AppFs.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := afero.TempFile(a.AppFs, dir, base+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	err = write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = a.AppFs.Chmod(tmp, 0600)
+	}
+	if err == nil {
+		err = a.AppFs.Rename(tmp, file)
+	}
+	if err != nil {
+		a.AppFs.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// DataWriteAtomic replaces the data file name with what write writes,
+// see writeAtomic.
+func (a *App) DataWriteAtomic(name string, write func(io.Writer) error) error {
+	return a.writeAtomic(a.dataFile(name), write)
+}
+
+// ConfigWriteAtomic replaces the config file name with what write
+// writes, see writeAtomic.
+func (a *App) ConfigWriteAtomic(name string, write func(io.Writer) error) error {
+	return a.writeAtomic(a.configFile(name), write)
+}
+
+// CacheWriteAtomic replaces the cache file name with what write writes,
+// see writeAtomic.
+func (a *App) CacheWriteAtomic(name string, write func(io.Writer) error) error {
+	return a.writeAtomic(a.cacheFile(name), write)
+}
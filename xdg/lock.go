@@ -0,0 +1,62 @@
+package xdg
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sync"
+)
+
+// Lock takes the advisory lock name in the app's runtime directory,
+// waiting for whoever has it, in this process or another, to let go.
+// Call the returned function to release it. Locks with different names
+// are independent, so take them in the same order everywhere.
+func (a *App) Lock(name string) (func(), error) {
+	dir, err := a.RuntimeDir()
+	if err != nil {
+		return nil, err
+	}
+	file := path.Join(dir, name+".lock")
+	f, err := a.AppFs.OpenFile(file, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open lock %s: %s", file, err)
+	}
+
+	osf, ok := f.(*os.File)
+	if !ok || !canFlock {
+		// not a real file, like in tests, or no flock here, so all we
+		// can do is keep out the rest of this process
+		f.Close()
+		mu := processLock(file)
+		mu.Lock()
+		return mu.Unlock, nil
+	}
+
+	if err := tryFlock(osf); err != nil {
+		glog.Verbose("waiting for another spotify process to finish with %s", name)
+		if err := flock(osf); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("couldn't lock %s: %s", file, err)
+		}
+	}
+	return func() {
+		funlock(osf)
+		f.Close()
+	}, nil
+}
+
+var processLocks = struct {
+	sync.Mutex
+	m map[string]*sync.Mutex
+}{m: make(map[string]*sync.Mutex)}
+
+func processLock(file string) *sync.Mutex {
+	processLocks.Lock()
+	defer processLocks.Unlock()
+	mu, ok := processLocks.m[file]
+	if !ok {
+		mu = new(sync.Mutex)
+		processLocks.m[file] = mu
+	}
+	return mu
+}
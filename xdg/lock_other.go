@@ -0,0 +1,14 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package xdg
+
+import (
+	"os"
+)
+
+const canFlock = false
+
+func tryFlock(f *os.File) error { return nil }
+func flock(f *os.File) error    { return nil }
+func funlock(f *os.File) error  { return nil }
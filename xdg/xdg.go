@@ -1,85 +1,216 @@
 package xdg
 
 import (
+	"fmt"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/brianloveswords/spotify/logger"
 	"github.com/spf13/afero"
 )
 
+// App is where an application keeps its files, following the XDG Base
+// Directory Specification:
+// https://specifications.freedesktop.org/basedir-spec/basedir-spec-latest.html
+//
+// The *Home and *Dirs fields are the base directories, which the app
+// gets a directory named App inside of. Empty ones fall back to the
+// spec's defaults under Home.
 type App struct {
 	Home  string
 	App   string
 	AppFs afero.Fs
+
+	DataHome   string
+	ConfigHome string
+	CacheHome  string
+	// DataDirs and ConfigDirs are searched, in order, after DataHome
+	// and ConfigHome by the Lookup methods. They're never written to.
+	DataDirs   []string
+	ConfigDirs []string
+	// Runtime is the base directory for sockets, locks and the like. If
+	// it's empty the app's cache directory is used instead.
+	Runtime string
 }
 
+// The defaults for the base directories, relative to Home.
 var DataDir = ".local/share"
 var ConfigDir = ".config"
 var CacheDir = ".cache"
 
+// The defaults for DataDirs and ConfigDirs.
+var DefaultDataDirs = []string{"/usr/local/share", "/usr/share"}
+var DefaultConfigDirs = []string{"/etc/xdg"}
+
 var glog = logger.DefaultLogger
 
+// NewApp returns the directories for the application name, taken from
+// the XDG_* environment variables. The directories are created as files
+// are written to them.
 func NewApp(name string) *App {
-	app := App{
-		Home:  os.Getenv("HOME"),
-		App:   name,
-		AppFs: afero.NewOsFs(),
+	return &App{
+		Home:       os.Getenv("HOME"),
+		App:        name,
+		AppFs:      afero.NewOsFs(),
+		DataHome:   envDir("XDG_DATA_HOME"),
+		ConfigHome: envDir("XDG_CONFIG_HOME"),
+		CacheHome:  envDir("XDG_CACHE_HOME"),
+		DataDirs:   envDirs("XDG_DATA_DIRS", DefaultDataDirs),
+		ConfigDirs: envDirs("XDG_CONFIG_DIRS", DefaultConfigDirs),
+		Runtime:    envDir("XDG_RUNTIME_DIR"),
+	}
+}
+
+// envDir returns the directory in the environment variable name. The
+// spec says relative paths are invalid and to be ignored.
+func envDir(name string) string {
+	dir := os.Getenv(name)
+	if dir != "" && !filepath.IsAbs(dir) {
+		glog.Debug("ignoring %s, %q isn't an absolute path", name, dir)
+		return ""
+	}
+	return dir
+}
+
+// envDirs returns the colon separated directories in the environment
+// variable name, or def if there aren't any.
+func envDirs(name string, def []string) []string {
+	var dirs []string
+	for _, dir := range strings.Split(os.Getenv(name), ":") {
+		if dir != "" && filepath.IsAbs(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	if len(dirs) == 0 {
+		return append([]string{}, def...)
+	}
+	return dirs
+}
+
+// Sub returns an app whose directories are nested inside a's, at name.
+// It shares a's base directories and filesystem.
+func (a *App) Sub(name string) *App {
+	sub := *a
+	sub.App = path.Join(a.App, name)
+	return &sub
+}
+
+func (a *App) dataHome() string {
+	return orDefault(a.DataHome, path.Join(a.Home, DataDir))
+}
+func (a *App) configHome() string {
+	return orDefault(a.ConfigHome, path.Join(a.Home, ConfigDir))
+}
+func (a *App) cacheHome() string {
+	return orDefault(a.CacheHome, path.Join(a.Home, CacheDir))
+}
+
+func orDefault(dir, def string) string {
+	if dir == "" {
+		return def
 	}
-	app.MakeDirs()
-	return &app
+	return dir
 }
 
-func (a *App) MakeDirs() {
-	var p string
-	var err error
-	p = path.Join(a.Home, DataDir, a.App)
-	if err = a.AppFs.MkdirAll(p, 0700); err != nil {
-		glog.Fatal("couldn't create local data storage directory: %s", err)
+// MakeDirs creates the app's data, cache and config directories.
+func (a *App) MakeDirs() error {
+	for _, dir := range []string{
+		path.Join(a.dataHome(), a.App),
+		path.Join(a.cacheHome(), a.App),
+		path.Join(a.configHome(), a.App),
+	} {
+		if err := a.AppFs.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("couldn't create %s: %s", dir, err)
+		}
 	}
-	p = path.Join(a.Home, CacheDir, a.App)
-	if err = a.AppFs.MkdirAll(p, 0700); err != nil {
-		glog.Fatal("couldn't create local data storage directory: %s", err)
+	return nil
+}
+
+// RuntimeDir returns the app's directory for sockets, locks and the
+// like, creating it if needed. Without a runtime base directory it's
+// the app's cache directory.
+func (a *App) RuntimeDir() (string, error) {
+	dir := path.Join(a.cacheHome(), a.App)
+	if a.Runtime != "" {
+		dir = path.Join(a.Runtime, a.App)
 	}
-	p = path.Join(a.Home, ConfigDir, a.App)
-	if err = a.AppFs.MkdirAll(p, 0700); err != nil {
-		glog.Fatal("couldn't create local data storage directory: %s", err)
+	if err := a.AppFs.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("couldn't create %s: %s", dir, err)
 	}
+	return dir, nil
 }
 
 var flags = os.O_RDWR | os.O_CREATE | os.O_TRUNC
 
+// create opens file for writing, creating its directory if needed.
+func (a *App) create(file string) (afero.File, error) {
+	if err := a.AppFs.MkdirAll(path.Dir(file), 0700); err != nil {
+		return nil, err
+	}
+	return a.AppFs.OpenFile(file, flags, 0600)
+}
+
+// lookup opens the first of name in the app's directory in home, then in
+// dirs, that exists.
+func (a *App) lookup(home string, dirs []string, name string) (afero.File, error) {
+	f, err := a.AppFs.Open(path.Join(home, a.App, name))
+	if !os.IsNotExist(err) {
+		return f, err
+	}
+	for _, dir := range dirs {
+		f, derr := a.AppFs.Open(path.Join(dir, a.App, name))
+		if !os.IsNotExist(derr) {
+			return f, derr
+		}
+	}
+	return nil, err
+}
+
 func (a *App) dataFile(name string) string {
-	return path.Join(a.Home, DataDir, a.App, name)
+	return path.Join(a.dataHome(), a.App, name)
 }
 func (a *App) DataCreate(name string) (afero.File, error) {
-	return a.AppFs.OpenFile(a.dataFile(name), flags, 0600)
+	return a.create(a.dataFile(name))
 }
 func (a *App) DataOpen(name string) (afero.File, error) {
 	return a.AppFs.Open(a.dataFile(name))
 }
+func (a *App) DataLookup(name string) (afero.File, error) {
+	return a.lookup(a.dataHome(), a.DataDirs, name)
+}
 func (a *App) DataRemove(name string) error {
 	return a.AppFs.Remove(a.dataFile(name))
 }
+func (a *App) DataRename(oldname, newname string) error {
+	return a.AppFs.Rename(a.dataFile(oldname), a.dataFile(newname))
+}
+func (a *App) DataReadDir(name string) ([]os.FileInfo, error) {
+	return afero.ReadDir(a.AppFs, a.dataFile(name))
+}
 
 func (a *App) configFile(name string) string {
-	return path.Join(a.Home, ConfigDir, a.App, name)
+	return path.Join(a.configHome(), a.App, name)
 }
 func (a *App) ConfigCreate(name string) (afero.File, error) {
-	return a.AppFs.OpenFile(a.configFile(name), flags, 0600)
+	return a.create(a.configFile(name))
 }
 func (a *App) ConfigOpen(name string) (afero.File, error) {
 	return a.AppFs.Open(a.configFile(name))
 }
+func (a *App) ConfigLookup(name string) (afero.File, error) {
+	return a.lookup(a.configHome(), a.ConfigDirs, name)
+}
 func (a *App) ConfigRemove(name string) error {
 	return a.AppFs.Remove(a.configFile(name))
 }
 
 func (a *App) cacheFile(name string) string {
-	return path.Join(a.Home, CacheDir, a.App, name)
+	return path.Join(a.cacheHome(), a.App, name)
 }
 func (a *App) CacheCreate(name string) (afero.File, error) {
-	return a.AppFs.OpenFile(a.cacheFile(name), flags, 0600)
+	return a.create(a.cacheFile(name))
 }
 func (a *App) CacheOpen(name string) (afero.File, error) {
 	return a.AppFs.Open(a.cacheFile(name))
@@ -87,3 +218,6 @@ func (a *App) CacheOpen(name string) (afero.File, error) {
 func (a *App) CacheRemove(name string) error {
 	return a.AppFs.Remove(a.cacheFile(name))
 }
+func (a *App) CacheRename(oldname, newname string) error {
+	return a.AppFs.Rename(a.cacheFile(oldname), a.cacheFile(newname))
+}
@@ -1,9 +1,13 @@
 package xdg
 
 import (
+	"errors"
+	"io"
 	"io/ioutil"
+	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
@@ -74,3 +78,175 @@ func TestXDGApp(t *testing.T) {
 	}
 
 }
+
+func TestNewAppFromEnv(t *testing.T) {
+	for name, value := range map[string]string{
+		"HOME":            "/home/test",
+		"XDG_DATA_HOME":   "/data",
+		"XDG_CONFIG_HOME": "relative/is/ignored",
+		"XDG_CACHE_HOME":  "",
+		"XDG_DATA_DIRS":   "/a:relative:/b:",
+		"XDG_CONFIG_DIRS": "",
+		"XDG_RUNTIME_DIR": "/run/user/1000",
+	} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+
+	app := NewApp("test-app")
+	app.AppFs = afero.NewMemMapFs()
+	assert.Equal(t, "/data/test-app/x", app.dataFile("x"))
+	assert.Equal(t, "/home/test/.config/test-app/x", app.configFile("x"))
+	assert.Equal(t, "/home/test/.cache/test-app/x", app.cacheFile("x"))
+	assert.Equal(t, []string{"/a", "/b"}, app.DataDirs)
+	assert.Equal(t, DefaultConfigDirs, app.ConfigDirs)
+
+	dir, err := app.RuntimeDir()
+	assert.NoError(t, err)
+	assert.Equal(t, "/run/user/1000/test-app", dir)
+	info, err := app.AppFs.Stat(dir)
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+}
+
+func TestRuntimeDirFallsBackToCache(t *testing.T) {
+	app := App{Home: "/", App: "test-app", AppFs: afero.NewMemMapFs()}
+	dir, err := app.RuntimeDir()
+	assert.NoError(t, err)
+	assert.Equal(t, "/.cache/test-app", dir)
+}
+
+func TestLookupSearchesDirs(t *testing.T) {
+	testfs := afero.NewMemMapFs()
+	app := App{
+		Home:       "/home/test",
+		App:        "test-app",
+		AppFs:      testfs,
+		DataDirs:   []string{"/usr/local/share", "/usr/share"},
+		ConfigDirs: []string{"/etc/xdg"},
+	}
+	read := func(f afero.File, err error) string {
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer f.Close()
+		b, _ := ioutil.ReadAll(f)
+		return string(b)
+	}
+
+	_, err := app.DataLookup("x")
+	assert.True(t, os.IsNotExist(err))
+
+	afero.WriteFile(testfs, "/usr/share/test-app/x", []byte("usr"), 0644)
+	assert.Equal(t, "usr", read(app.DataLookup("x")))
+	afero.WriteFile(testfs, "/usr/local/share/test-app/x", []byte("local"), 0644)
+	assert.Equal(t, "local", read(app.DataLookup("x")))
+	afero.WriteFile(testfs, "/home/test/.local/share/test-app/x", []byte("home"), 0644)
+	assert.Equal(t, "home", read(app.DataLookup("x")))
+
+	afero.WriteFile(testfs, "/etc/xdg/test-app/config", []byte("system"), 0644)
+	assert.Equal(t, "system", read(app.ConfigLookup("config")))
+}
+
+func TestSubAndMakeDirs(t *testing.T) {
+	testfs := afero.NewMemMapFs()
+	app := App{Home: "/", App: "test-app", AppFs: testfs, CacheHome: "/cache"}
+	sub := app.Sub("profiles/work")
+	assert.Equal(t, "/.local/share/test-app/profiles/work/x", sub.dataFile("x"))
+	assert.Equal(t, "/cache/test-app/profiles/work/x", sub.cacheFile("x"))
+
+	assert.NoError(t, sub.MakeDirs())
+	for _, dir := range []string{"/.local/share/test-app/profiles/work", "/.config/test-app/profiles/work", "/cache/test-app/profiles/work"} {
+		_, err := testfs.Stat(dir)
+		assert.NoError(t, err, dir)
+	}
+
+	readonly := App{Home: "/", App: "test-app", AppFs: afero.NewReadOnlyFs(afero.NewMemMapFs())}
+	assert.Error(t, readonly.MakeDirs())
+}
+
+func TestWriteAtomic(t *testing.T) {
+	testfs := afero.NewMemMapFs()
+	app := App{Home: "/", App: "test-app", AppFs: testfs}
+	write := func(s string) func(io.Writer) error {
+		return func(w io.Writer) error {
+			_, err := io.WriteString(w, s)
+			return err
+		}
+	}
+	contents := func() string {
+		b, err := afero.ReadFile(testfs, "/.cache/test-app/x")
+		assert.NoError(t, err)
+		return string(b)
+	}
+	files := func() int {
+		infos, err := afero.ReadDir(testfs, "/.cache/test-app")
+		assert.NoError(t, err)
+		return len(infos)
+	}
+
+	assert.NoError(t, app.CacheWriteAtomic("x", write("first")))
+	assert.Equal(t, "first", contents())
+	assert.NoError(t, app.CacheWriteAtomic("x", write("second")))
+	assert.Equal(t, "second", contents())
+	assert.Equal(t, 1, files())
+
+	// a failed write leaves the old file alone and cleans up after itself
+	err := app.CacheWriteAtomic("x", func(w io.Writer) error {
+		io.WriteString(w, "torn")
+		return errors.New("oops")
+	})
+	assert.EqualError(t, err, "oops")
+	assert.Equal(t, "second", contents())
+	assert.Equal(t, 1, files())
+
+	info, err := testfs.Stat("/.cache/test-app/x")
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+// testLock checks that a second holder of the lock has to wait for the
+// first.
+func testLock(t *testing.T, app *App) {
+	unlock, err := app.Lock("test")
+	assert.NoError(t, err)
+
+	locked := make(chan struct{})
+	go func() {
+		unlock2, err := app.Lock("test")
+		assert.NoError(t, err)
+		close(locked)
+		unlock2()
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("got the lock twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("lock wasn't released")
+	}
+
+	// other names are separate locks
+	unlock, err = app.Lock("test")
+	assert.NoError(t, err)
+	unlockOther, err := app.Lock("other")
+	assert.NoError(t, err)
+	unlockOther()
+	unlock()
+}
+
+func TestLockInMemory(t *testing.T) {
+	testLock(t, &App{Home: "/", App: "test-app", AppFs: afero.NewMemMapFs()})
+}
+
+func TestLockFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xdg-lock")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	testLock(t, &App{Home: dir, App: "test-app", AppFs: afero.NewOsFs(), Runtime: dir})
+}